@@ -10,13 +10,18 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/agoda-com/opentelemetry-go/otelzap"
+	"github.com/bengetch/otel-go/src/pkg/httpmetrics"
+	"github.com/bengetch/otel-go/src/pkg/httpretry"
+	"github.com/bengetch/otel-go/src/pkg/server"
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/upstream"
 	"github.com/gin-gonic/gin"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -32,9 +37,9 @@ var (
 )
 
 func initServiceName() {
-	ServiceName = os.Getenv("SERVICE_NAME")
+	ServiceName = telemetry.ServiceNameFromEnv()
 	if ServiceName == "" {
-		log.Fatal("SERVICE_NAME environment variable not set")
+		log.Fatal("OTEL_SERVICE_NAME environment variable not set")
 	}
 }
 
@@ -62,39 +67,58 @@ func initHelloRequestCount() {
 
 	helloRequestCount, err = Meter.Int64Counter(meterName,
 		metric.WithDescription("The number of requests to the `/` API"),
+		metric.WithUnit("{request}"),
 	)
 	if err != nil {
 		log.Fatalf("Failed to initialize %s.hello.requests Meter: %v\n", ServiceName, err)
 	}
 }
 
-func initHttpClient() {
+func initHttpClient(propagator propagation.TextMapPropagator) {
 	/*
 		create an http.Client instance with otelhttp transport configured. this transport configuration
-		ensures that trace context is correctly propagated across http requests
+		ensures that trace context is correctly propagated across http requests, in every format
+		selected through OTEL_PROPAGATORS. the httpmetrics transport within it records the latency of
+		every call, with `peer.service` naming the service that was called. the httpretry transport
+		around it sends a request again after a transient failure, with each attempt traced on its own
 	*/
 
+	transport := httpmetrics.NewTransport(
+		http.DefaultTransport,
+		httpmetrics.WithPeerService(EndpointServiceA, "service_a"),
+		httpmetrics.WithPeerService(EndpointServiceB, "service_b"),
+	)
 	Client = &http.Client{
 		Timeout:   time.Second * 10,
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: httpretry.NewTransport(otelhttp.NewTransport(transport, otelhttp.WithPropagators(propagator))),
 	}
 }
 
-func main() {
+func initTelemetry() *telemetry.Telemetry {
+	/*
+		configure logger, tracer and meter providers for this service. the exporter used for each
+		telemetry type is indicated by the OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER and
+		OTEL_LOGS_EXPORTER environment variables
+	*/
 
-	initServiceName()
-	initTracerGlobal()
-	initMeterGlobal()
-	initHelloRequestCount()
-	initHttpClient()
+	tel, err := telemetry.Init(context.Background(), telemetry.WithServiceName(ServiceName))
+	if err != nil {
+		log.Fatalf("Failed to initialize telemetry: %v\n", err)
+	}
 
-	logProvider := SetupLogs()
-	tracerProvider := SetupTraces()
-	meterProvider := SetupMetrics()
-	defer CleanupTelemetryProviders(logProvider, tracerProvider, meterProvider)
+	return tel
+}
+
+func newRouter(propagator propagation.TextMapPropagator) *gin.Engine {
+	/*
+		create the router of this service, with every request traced and measured
+	*/
 
 	router := gin.Default()
-	router.Use(otelgin.Middleware(ServiceName))
+	router.Use(
+		otelgin.Middleware(ServiceName, otelgin.WithPropagators(propagator)),
+		httpmetrics.Middleware(),
+	)
 
 	router.GET("/", hello)
 	router.GET("/basicA", callServiceA)
@@ -103,17 +127,33 @@ func main() {
 	router.GET("/chainedAsyncA", chainedAsyncCallServiceA)
 	router.GET("/inlineTraceEx", inlineTracesExample)
 
-	err := router.Run(fmt.Sprintf("0.0.0.0:%s", SelfPort))
+	return router
+}
+
+func main() {
+
+	initServiceName()
+	initTracerGlobal()
+	initMeterGlobal()
+	initHelloRequestCount()
+
+	tel := initTelemetry()
+	initHttpClient(tel.Propagator)
+
+	// serve until SIGINT/SIGTERM, then drain in-flight requests and flush telemetry before exiting
+	err := server.Run(
+		fmt.Sprintf("0.0.0.0:%s", SelfPort),
+		newRouter(tel.Propagator),
+		server.WithShutdownHook(tel.Shutdown),
+	)
 	if err != nil {
-		otelzap.Ctx(context.Background()).Fatal(
-			fmt.Sprintf("Failed to start the server: %v\n", err),
-		)
+		log.Fatalf("Server exited with error: %v\n", err)
 	}
 }
 
 func hello(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/` API of service %s", ServiceName),
 	)
 
@@ -133,7 +173,7 @@ func callServiceA(c *gin.Context) {
 		send a hello message and a random number to service A, return response from A to client
 	*/
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/basicA` API of service %s", ServiceName),
 	)
 
@@ -142,16 +182,18 @@ func callServiceA(c *gin.Context) {
 		Number:  rand.Intn(11),
 	}
 
-	response, status, err := makeRequest(
-		&requestToA,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_a",
 		fmt.Sprintf("http://%s/basicRequest", EndpointServiceA),
 		"POST",
+		&requestToA,
 		"message",
-		c.Request.Context(),
 	)
 
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -166,7 +208,7 @@ func callServiceB(c *gin.Context) {
 		send a hello message and a random number to service B, return response from B to client
 	*/
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/basicB` API of service %s", ServiceName),
 	)
 
@@ -175,15 +217,17 @@ func callServiceB(c *gin.Context) {
 		Number:  rand.Intn(11),
 	}
 
-	response, status, err := makeRequest(
-		&requestToB,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_b",
 		fmt.Sprintf("http://%s/basicRequest", EndpointServiceB),
 		"POST",
+		&requestToB,
 		"message",
-		c.Request.Context(),
 	)
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -200,7 +244,7 @@ func chainedCallServiceA(c *gin.Context) {
 		returned to the client
 	*/
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/chainedA` API of service %s", ServiceName),
 	)
 
@@ -209,15 +253,17 @@ func chainedCallServiceA(c *gin.Context) {
 		Number:  rand.Intn(11),
 	}
 
-	response, status, err := makeRequest(
-		&requestToA,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_a",
 		fmt.Sprintf("http://%s/chainedRequest", EndpointServiceA),
 		"POST",
+		&requestToA,
 		"message",
-		c.Request.Context(),
 	)
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -233,7 +279,7 @@ func chainedAsyncCallServiceA(c *gin.Context) {
 		service A does not wait for a response from service B before sending its response.
 	*/
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/chainedAsyncA` API of service %s", ServiceName),
 	)
 
@@ -242,15 +288,17 @@ func chainedAsyncCallServiceA(c *gin.Context) {
 		Number:  rand.Intn(11),
 	}
 
-	response, status, err := makeRequest(
-		&requestToA,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_a",
 		fmt.Sprintf("http://%s/chainedAsyncRequest", EndpointServiceA),
 		"POST",
+		&requestToA,
 		"message",
-		c.Request.Context(),
 	)
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -262,7 +310,7 @@ func chainedAsyncCallServiceA(c *gin.Context) {
 
 func inlineTracesExample(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/inlineTraceEx` API of service %s", ServiceName),
 	)
 
@@ -271,15 +319,17 @@ func inlineTracesExample(c *gin.Context) {
 		Number:  rand.Intn(6),
 	}
 
-	response, status, err := makeRequest(
-		&requestToA,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_a",
 		fmt.Sprintf("http://%s/addNumber", EndpointServiceA),
 		"POST",
+		&requestToA,
 		"number",
-		c.Request.Context(),
 	)
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -288,6 +338,7 @@ func inlineTracesExample(c *gin.Context) {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 				"message": fmt.Sprintf("couldn't convert response %s to int: %v", response, err),
 			})
+			return
 		}
 		if responseInt <= 5 {
 			_, childSpan := Tracer.Start(c.Request.Context(), "span-entrypoint-add-number-less-than-5")
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/telemetry/telemetrytest"
+	"github.com/gin-gonic/gin"
+
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setup(t *testing.T, serviceA http.HandlerFunc) *telemetrytest.Recorder {
+	/*
+		record the telemetry of this service in memory, and point it at a stand-in for service A
+	*/
+
+	gin.SetMode(gin.TestMode)
+	rec := telemetrytest.Install(t, telemetry.WithServiceName("entrypoint"))
+
+	stub := httptest.NewServer(serviceA)
+	t.Cleanup(stub.Close)
+	stubURL, err := url.Parse(stub.URL)
+	if err != nil {
+		t.Fatalf("failed to parse stub URL: %v", err)
+	}
+
+	ServiceName = "entrypoint"
+	EndpointServiceA = stubURL.Host
+	initTracerGlobal()
+	initMeterGlobal()
+	initHelloRequestCount()
+	initHttpClient(rec.Telemetry.Propagator)
+
+	return rec
+}
+
+func TestInlineTracesExample(t *testing.T) {
+	var received trace.SpanContext
+	rec := setup(t, func(w http.ResponseWriter, r *http.Request) {
+		received = trace.SpanContextFromContext(
+			propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)),
+		)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"number": "3"})
+	})
+
+	w := httptest.NewRecorder()
+	newRouter(rec.Telemetry.Propagator).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/inlineTraceEx", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /inlineTraceEx responded %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	server := rec.AssertSpan(t, "/inlineTraceEx", semconv.HTTPRoute("/inlineTraceEx"))
+	child := rec.AssertSpan(t, "span-entrypoint-add-number-less-than-5")
+	if child.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("span-entrypoint-add-number-less-than-5 has parent %s, want the server span %s",
+			child.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	attempt := rec.AssertSpan(t, "HTTP POST attempt")
+	for _, attr := range attempt.Attributes {
+		if attr.Key == semconv.HTTPRequestResendCountKey {
+			t.Errorf("the first attempt carries %s, which is only set on retries", attr.Key)
+		}
+	}
+
+	traceID := server.SpanContext.TraceID()
+	if received.TraceID() != traceID {
+		t.Errorf("service A received trace %s, want %s", received.TraceID(), traceID)
+	}
+
+	logs := rec.LogsForTrace(t, traceID)
+	want := fmt.Sprintf("hello from `/inlineTraceEx` API of service %s", ServiceName)
+	if len(logs) != 1 || logs[0].Body == nil || *logs[0].Body != want {
+		t.Errorf("LogsForTrace returned %d records, want a single record %q", len(logs), want)
+	}
+
+	if _, ok := rec.FindMetric(t, "http.server.request.duration"); !ok {
+		t.Errorf("http.server.request.duration was not recorded")
+	}
+}
+
+func TestInlineTracesExampleUpstreamFailure(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	rec := setup(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	w := httptest.NewRecorder()
+	newRouter(rec.Telemetry.Propagator).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/inlineTraceEx", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("GET /inlineTraceEx responded %d, want %d", w.Code, http.StatusBadGateway)
+	}
+
+	// the POST to service A carries an Idempotency-Key, so its 503 is retried with the same key
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 3 {
+		t.Fatalf("service A was called %d times, want 3", len(keys))
+	}
+	for _, key := range keys {
+		if key == "" || key != keys[0] {
+			t.Errorf("service A received Idempotency-Key headers %q, want the same key on every attempt", keys)
+			break
+		}
+	}
+	rec.AssertSpan(t, "HTTP POST attempt",
+		semconv.HTTPRequestResendCount(2),
+		semconv.HTTPResponseStatusCode(http.StatusServiceUnavailable),
+	)
+}
+
+func TestInlineTracesExampleInvalidNumber(t *testing.T) {
+	rec := setup(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"number": "three"})
+	})
+
+	w := httptest.NewRecorder()
+	newRouter(rec.Telemetry.Propagator).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/inlineTraceEx", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("GET /inlineTraceEx responded %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	// the handler stops at the failed conversion, so only the error is written
+	decoder := json.NewDecoder(w.Body)
+	var body map[string]string
+	if err := decoder.Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if want := "couldn't convert response three to int"; !strings.HasPrefix(body["message"], want) {
+		t.Errorf("response has message %q, want it to start with %q", body["message"], want)
+	}
+	if decoder.More() {
+		t.Errorf("response holds more than the error: %s", w.Body)
+	}
+	for _, span := range rec.Spans(t) {
+		if strings.HasPrefix(span.Name, "span-entrypoint-add-number-") {
+			t.Errorf("span %s was started after the conversion failed", span.Name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package httpmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// clientInstruments are the instruments of the HTTP semantic conventions for clients
+type clientInstruments struct {
+	duration       metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+	requestSize    metric.Int64Histogram
+	responseSize   metric.Int64Histogram
+}
+
+func newClientInstruments(cfg *config) *clientInstruments {
+	/*
+		create the client instruments. an instrument that cannot be created is reported to the global
+		error handler and replaced with a no-op, so that requests are still sent
+	*/
+
+	meter := cfg.meterProvider.Meter(instrumentationName)
+	i := &clientInstruments{}
+
+	var err error
+	if i.duration, err = meter.Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of HTTP client requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(cfg.durationBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.duration = noop.Float64Histogram{}
+	}
+	if i.activeRequests, err = meter.Int64UpDownCounter("http.client.active_requests",
+		metric.WithDescription("Number of active HTTP client requests"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		otel.Handle(err)
+		i.activeRequests = noop.Int64UpDownCounter{}
+	}
+	if i.requestSize, err = meter.Int64Histogram("http.client.request.body.size",
+		metric.WithDescription("Size of HTTP client request bodies"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(cfg.sizeBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.requestSize = noop.Int64Histogram{}
+	}
+	if i.responseSize, err = meter.Int64Histogram("http.client.response.body.size",
+		metric.WithDescription("Size of HTTP client response bodies"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(cfg.sizeBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.responseSize = noop.Int64Histogram{}
+	}
+
+	return i
+}
+
+// Transport records the metrics of the HTTP semantic conventions for clients about every request sent through
+// the wrapped RoundTripper
+type Transport struct {
+	base         http.RoundTripper
+	instruments  *clientInstruments
+	peerServices map[string]string
+}
+
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	/*
+		wrap `base`, or http.DefaultTransport if nil. requests are identified by `server.address` and
+		`server.port`, along with `peer.service` for endpoints registered through WithPeerService. wrap
+		it in otelhttp.NewTransport, rather than the other way around, so that measurements are taken
+		within the client span. bucket boundaries default to HTTP_CLIENT_DURATION_BUCKETS and
+		HTTP_CLIENT_SIZE_BUCKETS
+	*/
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := newConfig("HTTP_CLIENT", opts...)
+	return &Transport{base: base, instruments: newClientInstruments(cfg), peerServices: cfg.peerServices}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	attrs := []attribute.KeyValue{
+		methodAttribute(req.Method),
+		semconv.ServerAddress(host),
+		semconv.URLScheme(req.URL.Scheme),
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	if name, ok := t.peerServices[req.URL.Host]; ok {
+		attrs = append(attrs, semconv.PeerService(name))
+	}
+
+	active := metric.WithAttributeSet(attribute.NewSet(attrs...))
+	t.instruments.activeRequests.Add(ctx, 1, active)
+	defer t.instruments.activeRequests.Add(ctx, -1, active)
+
+	resp, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(errorType(err)))
+	} else {
+		attrs = append(attrs,
+			semconv.HTTPResponseStatusCode(resp.StatusCode),
+			semconv.NetworkProtocolVersion(protocolVersion(resp.ProtoMajor, resp.ProtoMinor)),
+		)
+		if resp.StatusCode >= http.StatusBadRequest {
+			attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode)))
+		}
+	}
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+	t.instruments.duration.Record(ctx, time.Since(start).Seconds(), set)
+	if req.ContentLength >= 0 {
+		t.instruments.requestSize.Record(ctx, req.ContentLength, set)
+	}
+	if resp != nil && resp.ContentLength >= 0 {
+		t.instruments.responseSize.Record(ctx, resp.ContentLength, set)
+	}
+
+	return resp, err
+}
+
+func errorType(err error) string {
+	/*
+		classify an error returned by a RoundTripper for `error.type`. timeouts and cancellations are
+		named as such, anything else by the type of the error, e.g. `*net.OpError`
+	*/
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return fmt.Sprintf("%T", err)
+	}
+}
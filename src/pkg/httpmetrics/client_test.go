@@ -0,0 +1,111 @@
+package httpmetrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+func TestTransport(t *testing.T) {
+	t.Setenv("HTTP_CLIENT_DURATION_BUCKETS", "")
+	t.Setenv("HTTP_CLIENT_SIZE_BUCKETS", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	// a listener that is closed right away gives an address that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	refused := listener.Addr().(*net.TCPAddr)
+	_ = listener.Close()
+
+	reader := sdkmetric.NewManualReader()
+	client := &http.Client{Transport: NewTransport(nil,
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithPeerService(serverURL.Host, "service_a"),
+	)}
+
+	resp, err := client.Post(server.URL+"/", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	resp, err = client.Get(server.URL + "/fail")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if _, err := client.Get("http://" + refused.String()); err == nil {
+		t.Fatalf("request to %s succeeded, want a refused connection", refused)
+	}
+
+	metrics := collect(t, reader)
+	checkUnits(t, metrics, map[string]string{
+		"http.client.request.duration":   "s",
+		"http.client.active_requests":    "{request}",
+		"http.client.request.body.size":  "By",
+		"http.client.response.body.size": "By",
+	})
+
+	peer := []attribute.KeyValue{
+		semconv.ServerAddress("127.0.0.1"),
+		semconv.ServerPort(port),
+		semconv.URLScheme("http"),
+		semconv.PeerService("service_a"),
+	}
+	with := func(attrs ...attribute.KeyValue) []attribute.KeyValue {
+		return append(slices.Clone(peer), attrs...)
+	}
+
+	ok := with(semconv.HTTPRequestMethodPost, semconv.HTTPResponseStatusCode(200), semconv.NetworkProtocolVersion("1.1"))
+	duration := histogramPoint[float64](t, metrics, "http.client.request.duration", ok...)
+	if duration.Count != 1 || !slices.Equal(duration.Bounds, defaultDurationBuckets) {
+		t.Errorf("http.client.request.duration has count %d and bounds %v, want 1 and %v",
+			duration.Count, duration.Bounds, defaultDurationBuckets)
+	}
+	if requestSize := histogramPoint[int64](t, metrics, "http.client.request.body.size", ok...); requestSize.Sum != 4 {
+		t.Errorf("http.client.request.body.size has sum %d, want 4", requestSize.Sum)
+	}
+	responseSize := histogramPoint[int64](t, metrics, "http.client.response.body.size", ok...)
+	if responseSize.Sum != 5 || !slices.Equal(responseSize.Bounds, defaultSizeBuckets) {
+		t.Errorf("http.client.response.body.size has sum %d and bounds %v, want 5 and %v",
+			responseSize.Sum, responseSize.Bounds, defaultSizeBuckets)
+	}
+
+	histogramPoint[float64](t, metrics, "http.client.request.duration", with(
+		semconv.HTTPRequestMethodGet,
+		semconv.HTTPResponseStatusCode(503),
+		semconv.NetworkProtocolVersion("1.1"),
+		semconv.ErrorTypeKey.String("503"),
+	)...)
+
+	// a request that got no response carries the type of its error, and no peer.service for an unknown endpoint
+	histogramPoint[float64](t, metrics, "http.client.request.duration",
+		semconv.HTTPRequestMethodGet,
+		semconv.ServerAddress("127.0.0.1"),
+		semconv.ServerPort(refused.Port),
+		semconv.URLScheme("http"),
+		semconv.ErrorTypeKey.String("*net.OpError"),
+	)
+}
@@ -0,0 +1,156 @@
+package httpmetrics
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// instrumentationName is the name of the meter used for the HTTP metrics recorded by this package
+const instrumentationName = "github.com/bengetch/otel-go/src/pkg/httpmetrics"
+
+// defaultDurationBuckets are the bucket boundaries, in seconds, advised by the HTTP semantic conventions for
+// request durations
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// defaultSizeBuckets are the bucket boundaries, in bytes, of request and response body sizes
+var defaultSizeBuckets = []float64{0, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// Option configures the metrics recorded by this package
+type Option func(*config)
+
+type config struct {
+	meterProvider   metric.MeterProvider
+	durationBuckets []float64
+	sizeBuckets     []float64
+	// peerServices maps the `host:port` of a downstream service to its name, reported as `peer.service`
+	peerServices map[string]string
+}
+
+func newConfig(prefix string, opts ...Option) *config {
+	/*
+		build a config by applying each option in order. bucket boundaries that are not set through an
+		option are read from <prefix>_DURATION_BUCKETS and <prefix>_SIZE_BUCKETS, e.g.
+		HTTP_SERVER_DURATION_BUCKETS, before falling back to their defaults
+	*/
+
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.meterProvider == nil {
+		cfg.meterProvider = otel.GetMeterProvider()
+	}
+	if cfg.durationBuckets == nil {
+		cfg.durationBuckets = bucketsFromEnv(prefix+"_DURATION_BUCKETS", defaultDurationBuckets)
+	}
+	if cfg.sizeBuckets == nil {
+		cfg.sizeBuckets = bucketsFromEnv(prefix+"_SIZE_BUCKETS", defaultSizeBuckets)
+	}
+
+	return cfg
+}
+
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	/*
+		record metrics through `mp` rather than the global meter provider
+	*/
+
+	return func(cfg *config) {
+		cfg.meterProvider = mp
+	}
+}
+
+func WithDurationBuckets(boundaries ...float64) Option {
+	/*
+		set the bucket boundaries, in seconds, of the request duration histogram
+	*/
+
+	return func(cfg *config) {
+		cfg.durationBuckets = boundaries
+	}
+}
+
+func WithSizeBuckets(boundaries ...float64) Option {
+	/*
+		set the bucket boundaries, in bytes, of the request and response body size histograms
+	*/
+
+	return func(cfg *config) {
+		cfg.sizeBuckets = boundaries
+	}
+}
+
+func WithPeerService(endpoint string, name string) Option {
+	/*
+		report requests sent to `endpoint`, a `host:port` such as the value of ENDPOINT_SERVICE_A, with
+		`peer.service` set to `name`. only used by NewTransport
+	*/
+
+	return func(cfg *config) {
+		if endpoint == "" {
+			return
+		}
+		if cfg.peerServices == nil {
+			cfg.peerServices = make(map[string]string)
+		}
+		cfg.peerServices[endpoint] = name
+	}
+}
+
+func bucketsFromEnv(name string, defaultBuckets []float64) []float64 {
+	/*
+		parse the environment variable `name` as a comma separated list of increasing bucket boundaries,
+		e.g. `0.01,0.1,1`, falling back to defaultBuckets if it is unset or invalid
+	*/
+
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultBuckets
+	}
+
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		boundary, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || len(buckets) > 0 && boundary <= buckets[len(buckets)-1] {
+			log.Printf("httpmetrics: invalid %s value %q, must be increasing numbers. using the defaults\n", name, value)
+			return defaultBuckets
+		}
+		buckets = append(buckets, boundary)
+	}
+	return buckets
+}
+
+// knownMethods are the request methods reported as they are. any other method is reported as `_OTHER`, so that
+// arbitrary methods sent by clients do not create new series
+var knownMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPatch,
+	http.MethodPost, http.MethodPut, http.MethodTrace,
+}
+
+func methodAttribute(method string) attribute.KeyValue {
+	if slices.Contains(knownMethods, method) {
+		return semconv.HTTPRequestMethodKey.String(method)
+	}
+	return semconv.HTTPRequestMethodOther
+}
+
+func protocolVersion(major int, minor int) string {
+	/*
+		return an HTTP version as the semantic conventions spell it, e.g. `1.1` or `2`
+	*/
+
+	if minor == 0 && major > 1 {
+		return strconv.Itoa(major)
+	}
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
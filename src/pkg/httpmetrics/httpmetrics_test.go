@@ -0,0 +1,93 @@
+package httpmetrics
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	/*
+		collect the metrics of `reader`, by name
+	*/
+
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != instrumentationName {
+			t.Errorf("metrics recorded by meter %q, want %q", sm.Scope.Name, instrumentationName)
+		}
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func checkUnits(t *testing.T, metrics map[string]metricdata.Metrics, units map[string]string) {
+	t.Helper()
+
+	for name, unit := range units {
+		m, ok := metrics[name]
+		if !ok {
+			t.Errorf("%s was not recorded", name)
+			continue
+		}
+		if m.Unit != unit {
+			t.Errorf("%s has unit %q, want %q", name, m.Unit, unit)
+		}
+	}
+}
+
+func histogramPoint[N int64 | float64](
+	t *testing.T, metrics map[string]metricdata.Metrics, name string, attrs ...attribute.KeyValue,
+) metricdata.HistogramDataPoint[N] {
+	/*
+		return the data point of histogram `name` with exactly the attributes `attrs`
+	*/
+
+	t.Helper()
+
+	histogram, ok := metrics[name].Data.(metricdata.Histogram[N])
+	if !ok {
+		t.Fatalf("%s has data %T, want a histogram", name, metrics[name].Data)
+	}
+	want := attribute.NewSet(attrs...)
+	for _, dp := range histogram.DataPoints {
+		if dp.Attributes.Equals(&want) {
+			return dp
+		}
+	}
+	var got []string
+	for _, dp := range histogram.DataPoints {
+		got = append(got, dp.Attributes.Encoded(attribute.DefaultEncoder()))
+	}
+	t.Fatalf("%s has no data point with attributes %s, got %v", name, want.Encoded(attribute.DefaultEncoder()), got)
+	return metricdata.HistogramDataPoint[N]{}
+}
+
+func TestBucketsFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  []float64
+	}{
+		{value: "", want: defaultSizeBuckets},
+		{value: "0.01, 0.1,1", want: []float64{0.01, 0.1, 1}},
+		{value: "1,0.1", want: defaultSizeBuckets},
+		{value: "1,a", want: defaultSizeBuckets},
+	} {
+		t.Setenv("HTTP_TEST_BUCKETS", tc.value)
+		if got := bucketsFromEnv("HTTP_TEST_BUCKETS", defaultSizeBuckets); !slices.Equal(got, tc.want) {
+			t.Errorf("bucketsFromEnv(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// serverInstruments are the instruments of the HTTP semantic conventions for servers
+type serverInstruments struct {
+	duration       metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+	requestSize    metric.Int64Histogram
+	responseSize   metric.Int64Histogram
+}
+
+func newServerInstruments(cfg *config) *serverInstruments {
+	/*
+		create the server instruments. an instrument that cannot be created is reported to the global
+		error handler and replaced with a no-op, so that requests are still served
+	*/
+
+	meter := cfg.meterProvider.Meter(instrumentationName)
+	i := &serverInstruments{}
+
+	var err error
+	if i.duration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(cfg.durationBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.duration = noop.Float64Histogram{}
+	}
+	if i.activeRequests, err = meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		otel.Handle(err)
+		i.activeRequests = noop.Int64UpDownCounter{}
+	}
+	if i.requestSize, err = meter.Int64Histogram("http.server.request.body.size",
+		metric.WithDescription("Size of HTTP server request bodies"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(cfg.sizeBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.requestSize = noop.Int64Histogram{}
+	}
+	if i.responseSize, err = meter.Int64Histogram("http.server.response.body.size",
+		metric.WithDescription("Size of HTTP server response bodies"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(cfg.sizeBuckets...),
+	); err != nil {
+		otel.Handle(err)
+		i.responseSize = noop.Int64Histogram{}
+	}
+
+	return i
+}
+
+func Middleware(opts ...Option) gin.HandlerFunc {
+	/*
+		record the request rate, errors and duration of every request handled by a gin router, following
+		the HTTP semantic conventions for server metrics. requests are identified by `http.route`, the
+		route template such as `/users/:id`, rather than the path, so that paths do not create new series.
+		register it next to otelgin.Middleware, so that exemplars link measurements to the server span.
+		bucket boundaries default to HTTP_SERVER_DURATION_BUCKETS and HTTP_SERVER_SIZE_BUCKETS
+	*/
+
+	instruments := newServerInstruments(newConfig("HTTP_SERVER", opts...))
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		// the context of the request carries the server span started by otelgin, if any
+		ctx := c.Request.Context()
+
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		active := metric.WithAttributes(methodAttribute(c.Request.Method), semconv.URLScheme(scheme))
+		instruments.activeRequests.Add(ctx, 1, active)
+		defer instruments.activeRequests.Add(ctx, -1, active)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []attribute.KeyValue{
+			methodAttribute(c.Request.Method),
+			semconv.URLScheme(scheme),
+			semconv.HTTPResponseStatusCode(status),
+			semconv.NetworkProtocolVersion(protocolVersion(c.Request.ProtoMajor, c.Request.ProtoMinor)),
+		}
+		// requests that match no route have no route template
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, semconv.HTTPRoute(route))
+		}
+		if status >= http.StatusInternalServerError {
+			attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+		}
+		set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+		instruments.duration.Record(ctx, time.Since(start).Seconds(), set)
+		if c.Request.ContentLength >= 0 {
+			instruments.requestSize.Record(ctx, c.Request.ContentLength, set)
+		}
+		instruments.responseSize.Record(ctx, int64(max(c.Writer.Size(), 0)), set)
+	}
+}
@@ -0,0 +1,120 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("HTTP_SERVER_DURATION_BUCKETS", "")
+	t.Setenv("HTTP_SERVER_SIZE_BUCKETS", "")
+	reader := sdkmetric.NewManualReader()
+
+	router := gin.New()
+	router.Use(Middleware(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))))
+	router.GET("/users/:id", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	for _, path := range []string{"/users/1", "/users/2", "/fail", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/users/1", nil))
+
+	metrics := collect(t, reader)
+	checkUnits(t, metrics, map[string]string{
+		"http.server.request.duration":   "s",
+		"http.server.active_requests":    "{request}",
+		"http.server.request.body.size":  "By",
+		"http.server.response.body.size": "By",
+	})
+
+	common := []attribute.KeyValue{
+		semconv.URLScheme("http"),
+		semconv.NetworkProtocolVersion("1.1"),
+	}
+	with := func(attrs ...attribute.KeyValue) []attribute.KeyValue {
+		return append(slices.Clone(common), attrs...)
+	}
+
+	// both users share the series of their route template
+	users := with(semconv.HTTPRequestMethodGet, semconv.HTTPRoute("/users/:id"), semconv.HTTPResponseStatusCode(200))
+	duration := histogramPoint[float64](t, metrics, "http.server.request.duration", users...)
+	if duration.Count != 2 {
+		t.Errorf("http.server.request.duration has count %d for /users/:id, want 2", duration.Count)
+	}
+	if !slices.Equal(duration.Bounds, defaultDurationBuckets) {
+		t.Errorf("http.server.request.duration has bounds %v, want %v", duration.Bounds, defaultDurationBuckets)
+	}
+	responseSize := histogramPoint[int64](t, metrics, "http.server.response.body.size", users...)
+	if responseSize.Sum != 4 || !slices.Equal(responseSize.Bounds, defaultSizeBuckets) {
+		t.Errorf("http.server.response.body.size has sum %d and bounds %v, want 4 and %v",
+			responseSize.Sum, responseSize.Bounds, defaultSizeBuckets)
+	}
+	histogramPoint[int64](t, metrics, "http.server.request.body.size", users...)
+
+	// server errors carry `error.type`, and requests that match no route have no route template
+	histogramPoint[float64](t, metrics, "http.server.request.duration", with(
+		semconv.HTTPRequestMethodGet,
+		semconv.HTTPRoute("/fail"),
+		semconv.HTTPResponseStatusCode(500),
+		semconv.ErrorTypeKey.String("500"),
+	)...)
+	histogramPoint[float64](t, metrics, "http.server.request.duration", with(
+		semconv.HTTPRequestMethodGet,
+		semconv.HTTPResponseStatusCode(404),
+	)...)
+	histogramPoint[float64](t, metrics, "http.server.request.duration", with(
+		semconv.HTTPRequestMethodOther,
+		semconv.HTTPResponseStatusCode(404),
+	)...)
+
+	active, ok := metrics["http.server.active_requests"].Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("http.server.active_requests has data %T, want a sum", metrics["http.server.active_requests"].Data)
+	}
+	for _, dp := range active.DataPoints {
+		if dp.Value != 0 {
+			t.Errorf("http.server.active_requests is %d for %s after every request ended, want 0",
+				dp.Value, dp.Attributes.Encoded(attribute.DefaultEncoder()))
+		}
+	}
+}
+
+func TestMiddlewareBuckets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reader := sdkmetric.NewManualReader()
+
+	router := gin.New()
+	router.Use(Middleware(
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithDurationBuckets(0.1, 1),
+		WithSizeBuckets(10, 100),
+	))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	metrics := collect(t, reader)
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodGet,
+		semconv.URLScheme("http"),
+		semconv.NetworkProtocolVersion("1.1"),
+		semconv.HTTPRoute("/"),
+		semconv.HTTPResponseStatusCode(204),
+	}
+	if got := histogramPoint[float64](t, metrics, "http.server.request.duration", attrs...).Bounds; !slices.Equal(got, []float64{0.1, 1}) {
+		t.Errorf("http.server.request.duration has bounds %v, want [0.1 1]", got)
+	}
+	if got := histogramPoint[int64](t, metrics, "http.server.response.body.size", attrs...).Bounds; !slices.Equal(got, []float64{10, 100}) {
+		t.Errorf("http.server.response.body.size has bounds %v, want [10 100]", got)
+	}
+}
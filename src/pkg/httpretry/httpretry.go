@@ -0,0 +1,229 @@
+package httpretry
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer and meter used for the attempts and retries of this package
+const instrumentationName = "github.com/bengetch/otel-go/src/pkg/httpretry"
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 2 * time.Second
+)
+
+// defaultRetryStatuses are the response statuses that are retried for idempotent requests. each of them tells that
+// the downstream service, or a proxy in front of it, most likely did not handle the request
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// idempotentMethods are the request methods that may be sent again after a failure of any kind, as sending them
+// more than once has the same effect as sending them once. a request with any other method is treated the same
+// when it carries an Idempotency-Key header
+var idempotentMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete,
+}
+
+// Option configures the retry policy of a Transport
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retryStatuses  []int
+	// retryNonIdempotent retries the retry statuses for requests that are not idempotent as well
+	retryNonIdempotent *bool
+}
+
+func newConfig(opts ...Option) *config {
+	/*
+		build a config by applying each option in order. settings that are not set through an option are
+		read from HTTP_CLIENT_RETRY_MAX_ATTEMPTS, HTTP_CLIENT_RETRY_INITIAL_BACKOFF,
+		HTTP_CLIENT_RETRY_MAX_BACKOFF, HTTP_CLIENT_RETRY_STATUSES and HTTP_CLIENT_RETRY_NON_IDEMPOTENT,
+		before falling back to their defaults
+	*/
+
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.tracerProvider == nil {
+		cfg.tracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.meterProvider == nil {
+		cfg.meterProvider = otel.GetMeterProvider()
+	}
+	if cfg.maxAttempts < 1 {
+		cfg.maxAttempts = intFromEnv("HTTP_CLIENT_RETRY_MAX_ATTEMPTS", defaultMaxAttempts)
+	}
+	if cfg.initialBackoff <= 0 {
+		cfg.initialBackoff = durationFromEnv("HTTP_CLIENT_RETRY_INITIAL_BACKOFF", defaultInitialBackoff)
+	}
+	if cfg.maxBackoff <= 0 {
+		cfg.maxBackoff = durationFromEnv("HTTP_CLIENT_RETRY_MAX_BACKOFF", defaultMaxBackoff)
+	}
+	cfg.maxBackoff = max(cfg.maxBackoff, cfg.initialBackoff)
+	if cfg.retryStatuses == nil {
+		cfg.retryStatuses = statusesFromEnv("HTTP_CLIENT_RETRY_STATUSES", defaultRetryStatuses)
+	}
+	if cfg.retryNonIdempotent == nil {
+		retry := boolFromEnv("HTTP_CLIENT_RETRY_NON_IDEMPOTENT")
+		cfg.retryNonIdempotent = &retry
+	}
+
+	return cfg
+}
+
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	/*
+		start the span of each attempt through `tp` rather than the global tracer provider
+	*/
+
+	return func(cfg *config) {
+		cfg.tracerProvider = tp
+	}
+}
+
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	/*
+		record retries and giveups through `mp` rather than the global meter provider
+	*/
+
+	return func(cfg *config) {
+		cfg.meterProvider = mp
+	}
+}
+
+func WithMaxAttempts(attempts int) Option {
+	/*
+		set the number of times a request is sent at most, including the first attempt. 1 disables retries
+	*/
+
+	return func(cfg *config) {
+		cfg.maxAttempts = attempts
+	}
+}
+
+func WithBackoff(initial time.Duration, maximum time.Duration) Option {
+	/*
+		set the delay before the first retry, which doubles with every further retry up to `maximum`
+	*/
+
+	return func(cfg *config) {
+		cfg.initialBackoff = initial
+		cfg.maxBackoff = maximum
+	}
+}
+
+func WithRetryStatuses(statuses ...int) Option {
+	/*
+		set the response statuses that are retried for idempotent requests. no statuses at all means that
+		only failures to send a request are retried
+	*/
+
+	return func(cfg *config) {
+		cfg.retryStatuses = append([]int{}, statuses...)
+	}
+}
+
+func WithNonIdempotentRetries(enabled bool) Option {
+	/*
+		retry the retry statuses for requests that are not idempotent, such as a POST without an
+		Idempotency-Key header, as well. the downstream service may then handle such a request more
+		than once, as a 502 or 504 does not tell whether it did. services that call each other in a
+		chain, and turn a failure of the service they call into one of these statuses, also retry the
+		retries of every service below them
+	*/
+
+	return func(cfg *config) {
+		cfg.retryNonIdempotent = &enabled
+	}
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		log.Printf("httpretry: invalid %s value %q, must be a positive integer. using %d\n", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("httpretry: invalid %s value %q, must be a positive duration. using %s\n", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func boolFromEnv(name string) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return false
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("httpretry: invalid %s value %q, must be a boolean. using false\n", name, value)
+		return false
+	}
+	return parsed
+}
+
+func statusesFromEnv(name string, defaultStatuses []int) []int {
+	/*
+		parse the environment variable `name` as a comma separated list of response statuses, e.g.
+		`502,503`. `none` disables retries on statuses
+	*/
+
+	value := strings.TrimSpace(os.Getenv(name))
+	switch value {
+	case "":
+		return defaultStatuses
+	case "none":
+		return []int{}
+	}
+
+	var statuses []int
+	for _, field := range strings.Split(value, ",") {
+		status, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || status < 100 || status > 599 {
+			log.Printf("httpretry: invalid %s value %q, must be HTTP status codes. using the defaults\n", name, value)
+			return defaultStatuses
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func isIdempotent(req *http.Request) bool {
+	return slices.Contains(idempotentMethods, req.Method) || req.Header.Get("Idempotency-Key") != ""
+}
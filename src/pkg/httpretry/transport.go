@@ -0,0 +1,267 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxDrainedBody is the number of bytes of a retried response that are read, so that its connection can be reused
+const maxDrainedBody = 4096
+
+// instruments count the requests that were sent again, and those that failed after retrying as far as allowed
+type instruments struct {
+	retries metric.Int64Counter
+	giveups metric.Int64Counter
+}
+
+func newInstruments(cfg *config) *instruments {
+	/*
+		create the retry instruments. an instrument that cannot be created is reported to the global error
+		handler and replaced with a no-op, so that requests are still sent
+	*/
+
+	meter := cfg.meterProvider.Meter(instrumentationName)
+	i := &instruments{}
+
+	var err error
+	if i.retries, err = meter.Int64Counter("http.client.request.retries",
+		metric.WithDescription("Number of HTTP client requests sent again after a failed attempt"),
+		metric.WithUnit("{retry}"),
+	); err != nil {
+		otel.Handle(err)
+		i.retries = noop.Int64Counter{}
+	}
+	if i.giveups, err = meter.Int64Counter("http.client.request.giveups",
+		metric.WithDescription("Number of HTTP client requests that failed after retrying as far as allowed"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		otel.Handle(err)
+		i.giveups = noop.Int64Counter{}
+	}
+
+	return i
+}
+
+// Transport sends a request again through the wrapped RoundTripper when an attempt fails in a way that is safe
+// to retry, waiting for an exponential backoff with jitter in between
+type Transport struct {
+	base        http.RoundTripper
+	cfg         *config
+	tracer      trace.Tracer
+	instruments *instruments
+}
+
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	/*
+		wrap `base`, or http.DefaultTransport if nil. an idempotent request, one with an idempotent method
+		or an Idempotency-Key header, is retried when its response status is one of the retry statuses or
+		when it could not be sent. any request is retried when the connection to the downstream service
+		was refused, as it was then never sent. retries stop once the attempts are used up or the next
+		one could not start before the deadline of the request context, e.g. that set by
+		http.Client.Timeout. each attempt is a child span, and each retry carries
+		`http.request.resend_count`, so wrap otelhttp.NewTransport in it, rather than the other way
+		around, for each attempt to have its own client span and trace context
+	*/
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := newConfig(opts...)
+	return &Transport{
+		base:        base,
+		cfg:         cfg,
+		tracer:      cfg.tracerProvider.Tracer(instrumentationName),
+		instruments: newInstruments(cfg),
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attrs := requestAttributes(req)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.send(attemptReq, attempt)
+
+		reason, retry := t.retryReason(req, resp, err)
+		if !retry {
+			return resp, err
+		}
+		reasonAttrs := metric.WithAttributes(append(attrs, semconv.ErrorTypeKey.String(reason))...)
+
+		delay := t.backoff(attempt)
+		if !t.canRetry(req, attempt, delay) {
+			t.instruments.giveups.Add(ctx, 1, reasonAttrs)
+			return resp, err
+		}
+		t.instruments.retries.Add(ctx, 1, reasonAttrs)
+		if resp != nil {
+			discard(resp)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *Transport) send(req *http.Request, attempt int) (*http.Response, error) {
+	/*
+		send a single attempt of `req` within its own span
+	*/
+
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindInternal)}
+	// the semantic conventions only set the resend count on requests that are sent again
+	if attempt > 0 {
+		opts = append(opts, trace.WithAttributes(semconv.HTTPRequestResendCount(attempt)))
+	}
+	ctx, span := t.tracer.Start(req.Context(), fmt.Sprintf("HTTP %s attempt", req.Method), opts...)
+	defer span.End()
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError || slices.Contains(t.cfg.retryStatuses, resp.StatusCode) {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+func (t *Transport) retryReason(req *http.Request, resp *http.Response, err error) (string, bool) {
+	/*
+		tell whether an attempt failed in a way that is safe to retry, along with the reason it failed,
+		reported as `error.type`
+	*/
+
+	if err == nil {
+		// a non-idempotent request may have been handled before the status was returned
+		if !isIdempotent(req) && !*t.cfg.retryNonIdempotent {
+			return "", false
+		}
+		if slices.Contains(t.cfg.retryStatuses, resp.StatusCode) {
+			return strconv.Itoa(resp.StatusCode), true
+		}
+		return "", false
+	}
+
+	// a request that was canceled, or ran out of time, by its caller is not retried
+	if req.Context().Err() != nil {
+		return "", false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "connection_refused", true
+	}
+	if !isIdempotent(req) {
+		return "", false
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout", true
+	}
+	return fmt.Sprintf("%T", err), true
+}
+
+func (t *Transport) canRetry(req *http.Request, attempt int, delay time.Duration) bool {
+	/*
+		tell whether another attempt may follow attempt `attempt` after waiting for `delay`
+	*/
+
+	if attempt+1 >= t.cfg.maxAttempts {
+		return false
+	}
+	// a body that cannot be read again cannot be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	return true
+}
+
+func (t *Transport) backoff(attempt int) time.Duration {
+	/*
+		return the delay before the retry that follows attempt `attempt`, counted from 0. the delay doubles
+		with every attempt up to the maximum backoff, and is then drawn at random from its upper half, so
+		that clients that failed together do not retry together
+	*/
+
+	delay := t.cfg.maxBackoff
+	if attempt < 32 {
+		delay = min(t.cfg.initialBackoff<<attempt, t.cfg.maxBackoff)
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+func rewind(req *http.Request) (*http.Request, error) {
+	/*
+		return a copy of `req` whose body is read again from the start
+	*/
+
+	retryReq := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retryReq, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	retryReq.Body = body
+	return retryReq, nil
+}
+
+func discard(resp *http.Response) {
+	/*
+		read what is left of a response that is not returned, up to a limit, and close it
+	*/
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainedBody))
+	_ = resp.Body.Close()
+}
+
+func requestAttributes(req *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+	}
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return attrs
+}
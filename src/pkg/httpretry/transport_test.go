@@ -0,0 +1,322 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// countingTransport counts the attempts that reach the wrapped transport, including those that are refused
+type countingTransport struct {
+	base     http.RoundTripper
+	attempts atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.attempts.Add(1)
+	return c.base.RoundTrip(req)
+}
+
+func newTestTransport(t *testing.T, opts ...Option) (*http.Client, *countingTransport) {
+	/*
+		return a client that retries through a Transport with short backoffs, and the transport that counts
+		its attempts
+	*/
+
+	t.Setenv("HTTP_CLIENT_RETRY_NON_IDEMPOTENT", "")
+	base := &countingTransport{base: http.DefaultTransport}
+	opts = append([]Option{WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond)}, opts...)
+	return &http.Client{Transport: NewTransport(base, opts...)}, base
+}
+
+func failingServer(t *testing.T, failures int, status int) *httptest.Server {
+	/*
+		start a server that responds with `status` to the first `failures` requests, and with 200 after that
+	*/
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if int(calls.Add(1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRetryStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		method       string
+		key          string
+		opts         []Option
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{name: "GET", method: http.MethodGet, wantStatus: http.StatusOK, wantAttempts: 3},
+		{name: "POST", method: http.MethodPost, wantStatus: http.StatusServiceUnavailable, wantAttempts: 1},
+		{name: "POST with key", method: http.MethodPost, key: "a", wantStatus: http.StatusOK, wantAttempts: 3},
+		{
+			name:         "POST with non-idempotent retries",
+			method:       http.MethodPost,
+			opts:         []Option{WithNonIdempotentRetries(true)},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "status not retried",
+			method:       http.MethodGet,
+			opts:         []Option{WithRetryStatuses(http.StatusTooManyRequests)},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, base := newTestTransport(t, tc.opts...)
+			server := failingServer(t, 2, http.StatusServiceUnavailable)
+
+			req, err := http.NewRequest(tc.method, server.URL, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tc.key != "" {
+				req.Header.Set("Idempotency-Key", tc.key)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("response status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if got := base.attempts.Load(); got != tc.wantAttempts {
+				t.Errorf("request was sent %d times, want %d", got, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryConnectionRefused(t *testing.T) {
+	// a listener that is closed right away gives an address that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	target := "http://" + listener.Addr().String()
+	_ = listener.Close()
+
+	client, base := newTestTransport(t)
+	resp, err := client.Post(target, "application/json", strings.NewReader("{}"))
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("request to %s succeeded, want a refused connection", target)
+	}
+	if got := base.attempts.Load(); got != 3 {
+		t.Errorf("request was sent %d times, want 3", got)
+	}
+}
+
+func TestRetryRewindsBody(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, _ := newTestTransport(t)
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"number":"3"}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 3 {
+		t.Fatalf("server received %d requests, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != `{"number":"3"}` {
+			t.Errorf("attempt %d sent body %q, want %q", i, body, `{"number":"3"}`)
+		}
+	}
+}
+
+func TestRetryBodyWithoutGetBody(t *testing.T) {
+	// a body that cannot be read again is not sent again
+	client, base := newTestTransport(t)
+	server := failingServer(t, 1, http.StatusServiceUnavailable)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := base.attempts.Load(); got != 1 {
+		t.Errorf("request was sent %d times, want 1", got)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	recorder := tracetest.NewSpanRecorder()
+	client, base := newTestTransport(t,
+		WithMaxAttempts(2),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+	)
+	server := failingServer(t, 5, http.StatusServiceUnavailable)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := base.attempts.Load(); got != 2 {
+		t.Errorf("request was sent %d times, want 2", got)
+	}
+
+	// only the retry carries the resend count
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d attempt spans were recorded, want 2", len(spans))
+	}
+	for i, span := range spans {
+		var resendCount attribute.Value
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.HTTPRequestResendCountKey {
+				resendCount = attr.Value
+			}
+		}
+		if i == 0 && resendCount.Type() != attribute.INVALID {
+			t.Errorf("the first attempt has %s %s, want none", semconv.HTTPRequestResendCountKey, resendCount.Emit())
+		}
+		if i == 1 && resendCount.AsInt64() != 1 {
+			t.Errorf("the retry has %s %s, want 1", semconv.HTTPRequestResendCountKey, resendCount.Emit())
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				if errorType, _ := dp.Attributes.Value(semconv.ErrorTypeKey); errorType.AsString() == "503" {
+					counts[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+	if counts["http.client.request.retries"] != 1 || counts["http.client.request.giveups"] != 1 {
+		t.Errorf("recorded %v with error.type 503, want a retry and a giveup", counts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := NewTransport(nil, WithBackoff(100*time.Millisecond, time.Second))
+
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 100 * time.Millisecond},
+		{attempt: 1, want: 200 * time.Millisecond},
+		{attempt: 3, want: 800 * time.Millisecond},
+		{attempt: 4, want: time.Second},
+		{attempt: 40, want: time.Second},
+	} {
+		// the delay is drawn from the upper half of the backoff
+		for range 100 {
+			if got := transport.backoff(tc.attempt); got < tc.want/2 || got > tc.want {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tc.attempt, got, tc.want/2, tc.want)
+			}
+		}
+	}
+}
+
+func TestRetryCanceledDuringBackoff(t *testing.T) {
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	client, base := newTestTransport(t, WithBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("request returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not canceled during the backoff")
+	}
+	if got := base.attempts.Load(); got != 1 {
+		t.Errorf("request was sent %d times, want 1", got)
+	}
+}
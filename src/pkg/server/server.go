@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 5 * time.Second
+
+// Option configures the behavior of Run
+type Option func(*config)
+
+type config struct {
+	shutdownTimeout time.Duration
+	shutdownHooks   []func(context.Context) error
+}
+
+func newConfig(opts ...Option) *config {
+	/*
+		build a config from the default values, then apply each option in order. the shutdown timeout
+		defaults to the value of the SHUTDOWN_TIMEOUT environment variable if it is a valid duration
+	*/
+
+	cfg := &config{shutdownTimeout: defaultShutdownTimeout}
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			cfg.shutdownTimeout = timeout
+		} else {
+			log.Printf("ignoring invalid SHUTDOWN_TIMEOUT value %q, using %s\n", value, defaultShutdownTimeout)
+		}
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func WithShutdownTimeout(timeout time.Duration) Option {
+	/*
+		set how long in-flight requests are given to complete once a shutdown signal is received. the
+		same duration bounds the shutdown hooks that run afterwards
+	*/
+
+	return func(cfg *config) {
+		cfg.shutdownTimeout = timeout
+	}
+}
+
+func WithShutdownHook(hook func(context.Context) error) Option {
+	/*
+		register a function to call after the server has stopped, e.g. to flush telemetry providers.
+		hooks are called in the order they were registered
+	*/
+
+	return func(cfg *config) {
+		cfg.shutdownHooks = append(cfg.shutdownHooks, hook)
+	}
+}
+
+func Run(addr string, handler http.Handler, opts ...Option) error {
+	/*
+		serve `handler` on `addr` until SIGINT or SIGTERM is received. on a signal, stop accepting new
+		connections, give in-flight requests up to the shutdown timeout to complete, then call each
+		shutdown hook. every error encountered along the way is returned, so callers can exit with a
+		non-zero code if e.g. buffered telemetry could not be flushed
+	*/
+
+	cfg := newConfig(opts...)
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		// the server stopped without a shutdown signal, e.g. because the port is already in use
+		errs = append(errs, fmt.Errorf("failed to start the server: %w", err))
+	case <-ctx.Done():
+		// restore default signal behavior, so that a second signal terminates the process immediately
+		stop()
+		log.Printf("received shutdown signal, draining in-flight requests for up to %s\n", cfg.shutdownTimeout)
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		if err := srv.Shutdown(drainCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain in-flight requests: %w", err))
+		}
+		cancel()
+	}
+
+	hookCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	for _, hook := range cfg.shutdownHooks {
+		if err := hook(hookCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
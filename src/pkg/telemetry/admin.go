@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultAdminPort is the port registered for the Prometheus exporter, and used unless ADMIN_PORT is set
+const defaultAdminPort = "9464"
+
+// adminServer serves endpoints that must not be exposed on the public router of a service, such as the
+// Prometheus `/metrics` endpoint, on a separate port. it is only started once a handler has been registered
+type adminServer struct {
+	addr   string
+	mux    *http.ServeMux
+	routes int
+	srv    *http.Server
+}
+
+func newAdminServer(cfg *config) *adminServer {
+	return &adminServer{
+		addr: fmt.Sprintf("0.0.0.0:%s", cfg.adminPort),
+		mux:  http.NewServeMux(),
+	}
+}
+
+func (a *adminServer) Handle(pattern string, handler http.Handler) {
+	a.mux.Handle(pattern, handler)
+	a.routes++
+}
+
+func (a *adminServer) Start() error {
+	/*
+		start listening on the admin address if any handler has been registered. the listener is bound
+		before returning, so that a port that is already in use fails Init rather than being logged
+		later on
+	*/
+
+	if a.routes == 0 {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", a.addr, err)
+	}
+	// with port 0 the listener is bound to an ephemeral port
+	a.addr = listener.Addr().String()
+
+	a.srv = &http.Server{Handler: a.mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := a.srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("telemetry: admin server on %s exited: %v\n", a.addr, err)
+		}
+	}()
+	log.Printf("telemetry: admin server listening on %s\n", a.addr)
+
+	return nil
+}
+
+func (a *adminServer) Shutdown(ctx context.Context) error {
+	if a == nil || a.srv == nil {
+		return nil
+	}
+	return a.srv.Shutdown(ctx)
+}
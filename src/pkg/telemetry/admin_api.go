@@ -0,0 +1,352 @@
+package telemetry
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// signals lists the telemetry signals in the order they are reported by the admin API
+var signals = []string{"traces", "metrics", "logs"}
+
+// runtimeControls holds the settings that can be changed through the admin API while the service is running.
+// each one is read by the live providers on every use, so that a change applies without restarting them
+type runtimeControls struct {
+	cfg *config
+	// resource is reported as the identity of the service, as it holds the attributes that are exported
+	resource *resource.Resource
+	logLevel zap.AtomicLevel
+	sampler  *switchableSampler
+	// exporters is keyed by signal. a disabled signal still records telemetry, but its exporters drop it
+	exporters map[string]*atomic.Bool
+	// mu serializes updates that touch more than one setting, so that they are applied all at once
+	mu sync.Mutex
+}
+
+func newRuntimeControls(cfg *config, res *resource.Resource) *runtimeControls {
+	c := &runtimeControls{
+		cfg:       cfg,
+		resource:  res,
+		logLevel:  zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		sampler:   newSwitchableSampler(cfg),
+		exporters: make(map[string]*atomic.Bool, len(signals)),
+	}
+	for _, signal := range signals {
+		c.exporters[signal] = &atomic.Bool{}
+		c.exporters[signal].Store(true)
+	}
+	return c
+}
+
+func (c *runtimeControls) exporterEnabled(signal string) *atomic.Bool {
+	return c.exporters[signal]
+}
+
+func (c *runtimeControls) exportersOf(signal string) []string {
+	switch signal {
+	case "traces":
+		return c.cfg.tracesExporters
+	case "metrics":
+		return c.cfg.metricsExporters
+	default:
+		return c.cfg.logsExporters
+	}
+}
+
+// leveledCore filters the entries written to a zap core by a level that can be changed at runtime. the
+// otelzap core only accepts a fixed level, so it is constructed at debug level and wrapped in a leveledCore
+type leveledCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c *leveledCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c *leveledCore) With(fields []zapcore.Field) zapcore.Core {
+	return &leveledCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *leveledCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// samplerState is a sampler together with the settings it was constructed from
+type samplerState struct {
+	sampler sdktrace.Sampler
+	name    string
+	ratio   float64
+}
+
+// switchableSampler delegates to a sampler that can be replaced at runtime. the tracer provider keeps the
+// sampler it was constructed with, so the switchableSampler is what it is given
+type switchableSampler struct {
+	cfg     *config
+	current atomic.Pointer[samplerState]
+}
+
+func newSwitchableSampler(cfg *config) *switchableSampler {
+	s := &switchableSampler{cfg: cfg}
+	s.current.Store(&samplerState{
+		sampler: newSampler(cfg),
+		name:    cmp.Or(cfg.sampler, samplerParentBasedAlwaysOn),
+		ratio:   parseSamplerRatio(cfg.samplerArg),
+	})
+	return s
+}
+
+func (s *switchableSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.current.Load().sampler.ShouldSample(p)
+}
+
+func (s *switchableSampler) Description() string {
+	return s.current.Load().sampler.Description()
+}
+
+func (s *switchableSampler) setRatio(ratio float64) *samplerState {
+	/*
+		replace the root sampler with one that samples `ratio` of all traces. a parent based sampler
+		stays parent based, and per-route ratios are kept
+	*/
+
+	name := samplerTraceIDRatio
+	switch s.current.Load().name {
+	case samplerAlwaysOn, samplerAlwaysOff, samplerTraceIDRatio:
+	default:
+		name = samplerParentBasedTraceIDRatio
+	}
+
+	cfg := *s.cfg
+	cfg.sampler = name
+	cfg.samplerArg = strconv.FormatFloat(ratio, 'f', -1, 64)
+
+	state := &samplerState{sampler: newSampler(&cfg), name: name, ratio: ratio}
+	s.current.Store(state)
+	return state
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	/*
+		reject requests that do not carry `Authorization: Bearer <token>`
+	*/
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="telemetry"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func registerAdminAPI(admin *adminServer, token string, controls *runtimeControls) {
+	/*
+		serve the admin API under /admin/ on the admin server. every endpoint requires the admin token,
+		and the API is left out entirely when no token is configured
+	*/
+
+	if token == "" {
+		return
+	}
+
+	handle := func(pattern string, handler http.HandlerFunc) {
+		admin.Handle(pattern, requireToken(token, handler))
+	}
+
+	// zap.AtomicLevel serves `GET` and `PUT` with a body of {"level": "debug"} itself
+	admin.Handle("/admin/log-level", requireToken(token, controls.logLevel))
+	handle("GET /admin/sampler", controls.getSampler)
+	handle("PUT /admin/sampler", controls.putSampler)
+	handle("GET /admin/exporters", controls.getExporters)
+	handle("PUT /admin/exporters", controls.putExporters)
+	handle("GET /admin/config", controls.getConfig)
+}
+
+type samplerResponse struct {
+	Sampler     string             `json:"sampler"`
+	Ratio       float64            `json:"ratio"`
+	Routes      map[string]float64 `json:"routes,omitempty"`
+	Description string             `json:"description"`
+}
+
+func (c *runtimeControls) samplerResponse(state *samplerState) samplerResponse {
+	return samplerResponse{
+		Sampler:     state.name,
+		Ratio:       state.ratio,
+		Routes:      c.cfg.routeRatios,
+		Description: state.sampler.Description(),
+	}
+}
+
+func (c *runtimeControls) getSampler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.samplerResponse(c.sampler.current.Load()))
+}
+
+func (c *runtimeControls) putSampler(w http.ResponseWriter, r *http.Request) {
+	/*
+		set the sampling ratio of traces from a body of {"ratio": 0.5}
+	*/
+
+	var body struct {
+		Ratio *float64 `json:"ratio"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Ratio == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": `expected a body of {"ratio": <0..1>}`})
+		return
+	}
+	if *body.Ratio < 0 || *body.Ratio > 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ratio must be a number between 0 and 1"})
+		return
+	}
+
+	c.mu.Lock()
+	state := c.sampler.setRatio(*body.Ratio)
+	c.mu.Unlock()
+
+	zap.L().Info("trace sampler changed through the admin API", zap.String("sampler", state.name),
+		zap.Float64("ratio", state.ratio))
+	writeJSON(w, http.StatusOK, c.samplerResponse(state))
+}
+
+type exporterStatus struct {
+	Exporters []string `json:"exporters"`
+	Enabled   bool     `json:"enabled"`
+}
+
+func (c *runtimeControls) exporterStatuses() map[string]exporterStatus {
+	statuses := make(map[string]exporterStatus, len(signals))
+	for _, signal := range signals {
+		statuses[signal] = exporterStatus{
+			Exporters: c.exportersOf(signal),
+			Enabled:   c.exporters[signal].Load(),
+		}
+	}
+	return statuses
+}
+
+func (c *runtimeControls) getExporters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.exporterStatuses())
+}
+
+func (c *runtimeControls) putExporters(w http.ResponseWriter, r *http.Request) {
+	/*
+		enable or disable the exporters of one or more signals from a body such as
+		{"traces": false, "logs": true}. the body is validated as a whole before any signal is changed
+	*/
+
+	var body map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": `expected a body such as {"traces": true, "metrics": false}`,
+		})
+		return
+	}
+	for signal := range body {
+		if _, ok := c.exporters[signal]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("unknown signal %q, must be one of %s", signal, strings.Join(signals, ", ")),
+			})
+			return
+		}
+	}
+
+	c.mu.Lock()
+	for signal, enabled := range body {
+		c.exporters[signal].Store(enabled)
+	}
+	statuses := c.exporterStatuses()
+	c.mu.Unlock()
+
+	zap.L().Info("exporters changed through the admin API", zap.Any("exporters", body))
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+type configResponse struct {
+	ServiceName           string                    `json:"service_name"`
+	ServiceVersion        string                    `json:"service_version,omitempty"`
+	DeploymentEnvironment string                    `json:"deployment_environment,omitempty"`
+	LogLevel              string                    `json:"log_level"`
+	SDKLogLevel           string                    `json:"sdk_log_level"`
+	Sampler               samplerResponse           `json:"sampler"`
+	SamplerDebug          bool                      `json:"sampler_debug"`
+	Exporters             map[string]exporterStatus `json:"exporters"`
+	ExemplarFilter        string                    `json:"exemplar_filter"`
+	ExportBufferSignals   []string                  `json:"export_buffer_signals,omitempty"`
+	Propagators           []string                  `json:"propagators"`
+	AdminPort             string                    `json:"admin_port"`
+	ConfigFile            string                    `json:"config_file,omitempty"`
+}
+
+func (c *runtimeControls) resourceAttribute(key attribute.Key) string {
+	value, ok := c.resource.Set().Value(key)
+	if !ok {
+		return ""
+	}
+	return value.Emit()
+}
+
+func (c *runtimeControls) getConfig(w http.ResponseWriter, r *http.Request) {
+	/*
+		report the configuration in effect, after options, environment variables, the configuration
+		file and changes made through the admin API have been applied. the service attributes are read
+		from the resource, where OTEL_RESOURCE_ATTRIBUTES may have overridden the options. secrets such
+		as OTLP headers are left out
+	*/
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	propagators := make([]string, 0, len(c.cfg.propagators))
+	for _, propagator := range c.cfg.propagators {
+		propagators = append(propagators, propagatorName(propagator))
+	}
+
+	writeJSON(w, http.StatusOK, configResponse{
+		ServiceName:           c.resourceAttribute(semconv.ServiceNameKey),
+		ServiceVersion:        c.resourceAttribute(semconv.ServiceVersionKey),
+		DeploymentEnvironment: c.resourceAttribute(semconv.DeploymentEnvironmentKey),
+		LogLevel:              c.logLevel.String(),
+		SDKLogLevel:           cmp.Or(c.cfg.logLevel, "info"),
+		Sampler:               c.samplerResponse(c.sampler.current.Load()),
+		SamplerDebug:          c.cfg.samplerDebug,
+		Exporters:             c.exporterStatuses(),
+		ExemplarFilter:        c.cfg.exemplarFilter,
+		ExportBufferSignals:   c.cfg.exportBufferSignals,
+		Propagators:           propagators,
+		AdminPort:             c.cfg.adminPort,
+		ConfigFile:            os.Getenv("OTEL_CONFIG_FILE"),
+	})
+}
+
+// ensure the wrappers satisfy the interfaces they stand in for
+var (
+	_ sdktrace.Sampler = (*switchableSampler)(nil)
+	_ zapcore.Core     = (*leveledCore)(nil)
+)
@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetConfigServiceAttributes(t *testing.T) {
+	// OTEL_RESOURCE_ATTRIBUTES takes precedence over the options, and the admin API reports what is exported
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=production,service.version=2.0.0")
+
+	cfg, err := newConfig(
+		WithServiceName("checkout"),
+		WithServiceVersion("1.0.0"),
+		WithDeploymentEnvironment("staging"),
+	)
+	if err != nil {
+		t.Fatalf("failed to resolve config: %v", err)
+	}
+	res, err := newResource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to construct resource: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	newRuntimeControls(cfg, res).getConfig(w, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+
+	var got configResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response %s: %v", w.Body, err)
+	}
+	if got.ServiceName != "checkout" {
+		t.Errorf("service_name = %q, want %q", got.ServiceName, "checkout")
+	}
+	if got.ServiceVersion != "2.0.0" {
+		t.Errorf("service_version = %q, want %q", got.ServiceVersion, "2.0.0")
+	}
+	if got.DeploymentEnvironment != "production" {
+		t.Errorf("deployment_environment = %q, want %q", got.DeploymentEnvironment, "production")
+	}
+}
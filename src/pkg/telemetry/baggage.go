@@ -0,0 +1,163 @@
+package telemetry
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/agoda-com/opentelemetry-go/otelzap"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"go.uber.org/zap"
+)
+
+// defaultBaggageValueLength bounds the length of a baggage value copied onto spans and log records, unless
+// BAGGAGE_ATTRIBUTES_MAX_LENGTH says otherwise
+const defaultBaggageValueLength = 128
+
+// baggageSettings select the baggage members that are copied onto spans and log records
+type baggageSettings struct {
+	// keys holds normalized baggage keys. a key ending in `*` matches every key with that prefix
+	keys []string
+	// maxLength is the maximum number of characters of a value, longer values are truncated
+	maxLength int
+	// prefix is prepended to the attribute key, e.g. `baggage.`
+	prefix string
+}
+
+func parseBaggageSettings(allowlist string, maxLength string, prefix string) *baggageSettings {
+	/*
+		parse a comma separated allowlist of baggage keys, e.g. `tenant.id,user.tier,request.*`, along
+		with the value length limit and attribute key prefix. returns nil if the allowlist is empty
+	*/
+
+	s := &baggageSettings{maxLength: defaultBaggageValueLength, prefix: strings.TrimSpace(prefix)}
+	for _, key := range strings.Split(allowlist, ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if wildcard := strings.HasSuffix(key, "*"); wildcard {
+			s.keys = append(s.keys, normalizeBaggageKey(strings.TrimSuffix(key, "*"))+"*")
+		} else {
+			s.keys = append(s.keys, normalizeBaggageKey(key))
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil
+	}
+
+	if maxLength = strings.TrimSpace(maxLength); maxLength != "" {
+		n, err := strconv.Atoi(maxLength)
+		if err != nil || n <= 0 {
+			log.Printf("telemetry: invalid baggage value length %q, must be a positive integer. using %d\n",
+				maxLength, defaultBaggageValueLength)
+		} else {
+			s.maxLength = n
+		}
+	}
+
+	return s
+}
+
+func normalizeBaggageKey(key string) string {
+	/*
+		normalize a baggage key into an attribute key: lowercase, with every run of characters other
+		than letters, digits, `.` and `_` replaced by a single `_`. `Tenant-ID` becomes `tenant_id`
+	*/
+
+	var b strings.Builder
+	replaced := false
+	for _, r := range strings.ToLower(strings.TrimSpace(key)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' {
+			b.WriteRune(r)
+			replaced = false
+		} else if !replaced {
+			b.WriteByte('_')
+			replaced = true
+		}
+	}
+	return b.String()
+}
+
+func (s *baggageSettings) attributes(bag baggage.Baggage) []attribute.KeyValue {
+	/*
+		convert the allowlisted members of `bag` into attributes, truncating long values
+	*/
+
+	var attrs []attribute.KeyValue
+	for _, member := range bag.Members() {
+		key := normalizeBaggageKey(member.Key())
+		if !matchesKey(s.keys, key) {
+			continue
+		}
+
+		value := member.Value()
+		if utf8.RuneCountInString(value) > s.maxLength {
+			value = string([]rune(value)[:s.maxLength])
+		}
+		attrs = append(attrs, attribute.String(s.prefix+key, value))
+	}
+	return attrs
+}
+
+// logBaggage holds the settings of the last Init, which Ctx copies baggage onto log records with. it is nil when
+// no baggage is allowlisted
+var logBaggage atomic.Pointer[baggageSettings]
+
+func Ctx(ctx context.Context) *otelzap.Logger {
+	/*
+		return the global logger with the trace context and the allowlisted baggage of `ctx` attached to every
+		record it writes, as otelzap.Ctx does for the trace context alone. log records do not carry a context,
+		so baggage only reaches the records written through the logger returned here, and not those written
+		through otelzap.Ctx or zap.L. the baggage is copied whether or not a span is recording
+	*/
+
+	logger := otelzap.Ctx(ctx)
+	settings := logBaggage.Load()
+	if settings == nil {
+		return logger
+	}
+
+	attrs := settings.attributes(baggage.FromContext(ctx))
+	if len(attrs) == 0 {
+		return logger
+	}
+	fields := make([]zap.Field, 0, len(attrs))
+	for _, attr := range attrs {
+		fields = append(fields, zap.String(string(attr.Key), attr.Value.AsString()))
+	}
+	return logger.With(fields...)
+}
+
+// baggageSpanProcessor copies allowlisted baggage members onto spans as they start
+type baggageSpanProcessor struct {
+	settings *baggageSettings
+}
+
+func newBaggageSpanProcessor(cfg *config) *baggageSpanProcessor {
+	if cfg.baggage == nil {
+		return nil
+	}
+	return &baggageSpanProcessor{settings: cfg.baggage}
+}
+
+func (p *baggageSpanProcessor) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	if attrs := p.settings.attributes(baggage.FromContext(ctx)); len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+}
+
+func (p *baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (p *baggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// ensure the baggage processor can be registered with the tracer provider
+var _ sdktrace.SpanProcessor = (*baggageSpanProcessor)(nil)
@@ -0,0 +1,107 @@
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agoda-com/opentelemetry-go/otelzap"
+	"github.com/agoda-com/opentelemetry-logs-go/sdk/logs/logstest"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/telemetry/telemetrytest"
+)
+
+func withBaggage(t *testing.T, members ...string) context.Context {
+	var parsed []baggage.Member
+	for _, member := range members {
+		m, err := baggage.Parse(member)
+		if err != nil {
+			t.Fatalf("failed to parse baggage %q: %v", member, err)
+		}
+		parsed = append(parsed, m.Members()...)
+	}
+	bag, err := baggage.New(parsed...)
+	if err != nil {
+		t.Fatalf("failed to create baggage: %v", err)
+	}
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+func recordAttributes(record logstest.LogRecordStub) []attribute.KeyValue {
+	if record.Attributes == nil {
+		return nil
+	}
+	return *record.Attributes
+}
+
+func TestBaggageOnLogs(t *testing.T) {
+	// no trace is sampled, so that log records are only enriched by the logger Ctx returns
+	rec := telemetrytest.Install(t,
+		telemetry.WithBaggageAttributes("tenant.id"),
+		telemetry.WithTracesSampler("always_off", ""),
+	)
+	ctx := withBaggage(t, "tenant.id=a", "session=secret")
+
+	telemetry.Ctx(ctx).Info("without a span")
+	spanCtx, span := otel.Tracer("telemetry").Start(ctx, "unsampled")
+	telemetry.Ctx(spanCtx).Info("within an unsampled span")
+	span.End()
+	telemetry.Ctx(context.Background()).Info("without baggage")
+	// log records do not carry a context, so only the logger Ctx returns copies baggage onto them
+	otelzap.Ctx(ctx).Info("through otelzap")
+
+	logs := rec.Logs(t)
+	if len(logs) != 4 {
+		t.Fatalf("Logs returned %d records, want 4", len(logs))
+	}
+	for i, want := range [][]attribute.KeyValue{
+		{attribute.String("tenant.id", "a")},
+		{attribute.String("tenant.id", "a")},
+		nil,
+		nil,
+	} {
+		got := recordAttributes(logs[i])
+		if len(got) != len(want) {
+			t.Errorf("record %q has attributes %v, want %v", *logs[i].Body, got, want)
+			continue
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("record %q has attributes %v, want %v", *logs[i].Body, got, want)
+			}
+		}
+	}
+}
+
+func TestBaggageNotAllowlisted(t *testing.T) {
+	// without an allowlist no baggage is copied onto records
+	rec := telemetrytest.Install(t)
+
+	telemetry.Ctx(withBaggage(t, "tenant.id=a")).Info("with baggage")
+
+	logs := rec.Logs(t)
+	if len(logs) != 1 {
+		t.Fatalf("Logs returned %d records, want 1", len(logs))
+	}
+	if attrs := recordAttributes(logs[0]); len(attrs) != 0 {
+		t.Errorf("record has attributes %v, want none", attrs)
+	}
+}
+
+func TestBaggageOnSpans(t *testing.T) {
+	rec := telemetrytest.Install(t, telemetry.WithBaggageAttributes("tenant.id"))
+
+	_, span := otel.Tracer("telemetry").Start(withBaggage(t, "tenant.id=a", "session=secret"), "work")
+	span.End()
+
+	got := rec.AssertSpan(t, "work", attribute.String("tenant.id", "a"))
+	for _, attr := range got.Attributes {
+		if attr.Key == "session" {
+			t.Errorf("span carries baggage member %s, which is not allowlisted", attr.Key)
+		}
+	}
+}
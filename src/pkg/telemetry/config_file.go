@@ -0,0 +1,1165 @@
+package telemetry
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"gopkg.in/yaml.v3"
+)
+
+// supportedFileFormats lists the versions of the declarative configuration schema that can be loaded. earlier
+// versions describe resource attributes and OTLP headers as mappings rather than lists, which are not parsed
+var supportedFileFormats = []string{"0.3"}
+
+// the types below mirror the subset of the OpenTelemetry declarative configuration schema that is supported.
+// `file` and `memory` are exporters of this module rather than of the schema
+
+type fileConfig struct {
+	FileFormat     string              `yaml:"file_format"`
+	Disabled       *bool               `yaml:"disabled"`
+	LogLevel       string              `yaml:"log_level"`
+	Resource       *fileResource       `yaml:"resource"`
+	Propagator     *filePropagator     `yaml:"propagator"`
+	TracerProvider *fileTracerProvider `yaml:"tracer_provider"`
+	MeterProvider  *fileMeterProvider  `yaml:"meter_provider"`
+	LoggerProvider *fileLoggerProvider `yaml:"logger_provider"`
+}
+
+type fileResource struct {
+	Attributes []fileAttribute `yaml:"attributes"`
+}
+
+type fileAttribute struct {
+	Name  string `yaml:"name"`
+	Value any    `yaml:"value"`
+	Type  string `yaml:"type"`
+}
+
+type filePropagator struct {
+	Composite []string `yaml:"composite"`
+}
+
+type fileTracerProvider struct {
+	Processors []fileProcessor `yaml:"processors"`
+	Sampler    *fileSampler    `yaml:"sampler"`
+}
+
+type fileLoggerProvider struct {
+	Processors []fileProcessor `yaml:"processors"`
+}
+
+type fileProcessor struct {
+	Batch  *fileBatchProcessor  `yaml:"batch"`
+	Simple *fileSimpleProcessor `yaml:"simple"`
+}
+
+type fileBatchProcessor struct {
+	ScheduleDelay      *int         `yaml:"schedule_delay"`
+	ExportTimeout      *int         `yaml:"export_timeout"`
+	MaxQueueSize       *int         `yaml:"max_queue_size"`
+	MaxExportBatchSize *int         `yaml:"max_export_batch_size"`
+	Exporter           fileExporter `yaml:"exporter"`
+}
+
+type fileSimpleProcessor struct {
+	Exporter fileExporter `yaml:"exporter"`
+}
+
+type fileExporter struct {
+	OTLP    *fileOTLPExporter `yaml:"otlp"`
+	Console *struct{}         `yaml:"console"`
+	File    *struct{}         `yaml:"file"`
+	Memory  *struct{}         `yaml:"memory"`
+}
+
+type fileOTLPExporter struct {
+	Protocol          string          `yaml:"protocol"`
+	Endpoint          string          `yaml:"endpoint"`
+	Certificate       string          `yaml:"certificate"`
+	ClientKey         string          `yaml:"client_key"`
+	ClientCertificate string          `yaml:"client_certificate"`
+	Headers           []fileNameValue `yaml:"headers"`
+	HeadersList       string          `yaml:"headers_list"`
+	Compression       string          `yaml:"compression"`
+	Timeout           *int            `yaml:"timeout"`
+	Insecure          *bool           `yaml:"insecure"`
+	// only valid for metrics
+	TemporalityPreference       string `yaml:"temporality_preference"`
+	DefaultHistogramAggregation string `yaml:"default_histogram_aggregation"`
+}
+
+type fileNameValue struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type fileSampler struct {
+	AlwaysOn          *struct{}               `yaml:"always_on"`
+	AlwaysOff         *struct{}               `yaml:"always_off"`
+	TraceIDRatioBased *fileRatioSampler       `yaml:"trace_id_ratio_based"`
+	ParentBased       *fileParentBasedSampler `yaml:"parent_based"`
+}
+
+type fileRatioSampler struct {
+	Ratio *float64 `yaml:"ratio"`
+}
+
+type fileParentBasedSampler struct {
+	Root *fileSampler `yaml:"root"`
+}
+
+type fileMeterProvider struct {
+	Readers        []fileMetricReader `yaml:"readers"`
+	Views          []fileView         `yaml:"views"`
+	ExemplarFilter string             `yaml:"exemplar_filter"`
+}
+
+type fileMetricReader struct {
+	Periodic *filePeriodicReader `yaml:"periodic"`
+	Pull     *filePullReader     `yaml:"pull"`
+}
+
+type filePeriodicReader struct {
+	Interval *int         `yaml:"interval"`
+	Timeout  *int         `yaml:"timeout"`
+	Exporter fileExporter `yaml:"exporter"`
+}
+
+type filePullReader struct {
+	Exporter filePullExporter `yaml:"exporter"`
+}
+
+type filePullExporter struct {
+	Prometheus *filePrometheusExporter `yaml:"prometheus"`
+	Memory     *struct{}               `yaml:"memory"`
+}
+
+// filePrometheusExporter only supports `port`. the metrics are served by the admin server, whose host, and the
+// naming of the metrics, are not configurable, so any other setting of the schema is rejected
+type filePrometheusExporter struct {
+	Port *int `yaml:"port"`
+}
+
+type fileView struct {
+	Selector fileViewSelector `yaml:"selector"`
+	Stream   fileViewStream   `yaml:"stream"`
+}
+
+type fileViewSelector struct {
+	InstrumentName string `yaml:"instrument_name"`
+	InstrumentType string `yaml:"instrument_type"`
+	Unit           string `yaml:"unit"`
+	MeterName      string `yaml:"meter_name"`
+	MeterVersion   string `yaml:"meter_version"`
+	MeterSchemaURL string `yaml:"meter_schema_url"`
+}
+
+type fileViewStream struct {
+	Name          string              `yaml:"name"`
+	Description   string              `yaml:"description"`
+	Aggregation   *fileAggregation    `yaml:"aggregation"`
+	AttributeKeys *fileIncludeExclude `yaml:"attribute_keys"`
+}
+
+type fileIncludeExclude struct {
+	Included []string `yaml:"included"`
+	Excluded []string `yaml:"excluded"`
+}
+
+type fileAggregation struct {
+	Default                         *struct{}                    `yaml:"default"`
+	Drop                            *struct{}                    `yaml:"drop"`
+	Sum                             *struct{}                    `yaml:"sum"`
+	LastValue                       *struct{}                    `yaml:"last_value"`
+	ExplicitBucketHistogram         *fileExplicitBucketHistogram `yaml:"explicit_bucket_histogram"`
+	Base2ExponentialBucketHistogram *fileExponentialHistogram    `yaml:"base2_exponential_bucket_histogram"`
+}
+
+type fileExplicitBucketHistogram struct {
+	Boundaries   []float64 `yaml:"boundaries"`
+	RecordMinMax *bool     `yaml:"record_min_max"`
+}
+
+type fileExponentialHistogram struct {
+	MaxScale     *int32 `yaml:"max_scale"`
+	MaxSize      *int32 `yaml:"max_size"`
+	RecordMinMax *bool  `yaml:"record_min_max"`
+}
+
+// configFileSettings is what a configuration file resolves to. settings that have an environment variable are kept as
+// the value of that variable, so that they are parsed the same way and a variable that is set takes precedence
+type configFileSettings struct {
+	env                map[string]string
+	resourceAttributes []attribute.KeyValue
+	views              []sdkmetric.View
+	// processors holds the processor, or reader, settings of every exporter by signal and exporter type
+	processors map[string]map[string]*processorSettings
+}
+
+// processorSettings describe the processor of a single span or log exporter, or the reader of a metric exporter.
+// zero values leave the default, or the value of the corresponding environment variable, in place
+type processorSettings struct {
+	// simple exports every span or log record as soon as it ends, instead of in batches
+	simple             bool
+	scheduleDelay      time.Duration
+	exportTimeout      time.Duration
+	maxQueueSize       int
+	maxExportBatchSize int
+}
+
+// configFileState holds the settings loaded from OTEL_CONFIG_FILE. the file is loaded once, on first use, so that
+// functions such as ServiceNameFromEnv see the same settings as Init
+var configFileState struct {
+	once     sync.Once
+	settings *configFileSettings
+	err      error
+}
+
+func loadedConfigFile() (*configFileSettings, error) {
+	/*
+		return the settings of the file named by OTEL_CONFIG_FILE, or nil if it is not set
+	*/
+
+	configFileState.once.Do(func() {
+		path := strings.TrimSpace(os.Getenv("OTEL_CONFIG_FILE"))
+		if path == "" {
+			return
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			configFileState.err = fmt.Errorf("failed to read OTEL_CONFIG_FILE: %w", err)
+			return
+		}
+		if configFileState.settings, err = parseConfigFile(data); err != nil {
+			configFileState.err = fmt.Errorf("invalid OTEL_CONFIG_FILE %s: %w", path, err)
+		}
+	})
+
+	return configFileState.settings, configFileState.err
+}
+
+func configFileEnv(name string) string {
+	/*
+		return the value the configuration file gives to the environment variable `name`, if any
+	*/
+
+	settings, _ := loadedConfigFile()
+	if settings == nil {
+		return ""
+	}
+	return settings.env[name]
+}
+
+func getenv(name string) string {
+	/*
+		return the value of the environment variable `name`, falling back to the value configured by
+		the configuration file
+	*/
+
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return configFileEnv(name)
+}
+
+func parseConfigFile(data []byte) (*configFileSettings, error) {
+	/*
+		parse and validate a configuration file. environment variables referenced as `${NAME}`,
+		`${env:NAME}` or `${NAME:-default}` are substituted in scalar values before the file is
+		validated, and `$$` stands for a literal `$`. errors name the line and path of the offending
+		value
+	*/
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	doc := root.Content[0]
+
+	if err := substituteEnvNodes(doc); err != nil {
+		return nil, err
+	}
+
+	p := &fileParser{lines: make(map[string]int)}
+	if err := checkFileFormat(doc); err != nil {
+		return nil, err
+	}
+	if err := p.check(doc, reflect.TypeOf(fileConfig{}), ""); err != nil {
+		return nil, err
+	}
+
+	var fc fileConfig
+	if err := doc.Decode(&fc); err != nil {
+		return nil, err
+	}
+
+	return p.resolve(&fc)
+}
+
+// envReference matches a reference to an environment variable, or the `$$` escape sequence
+var envReference = regexp.MustCompile(`\$\$|\$\{(?:env:)?([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+func substituteEnvNodes(node *yaml.Node) error {
+	/*
+		substitute environment variable references in every scalar value below `node`. mapping keys are
+		left alone. the type of a plain scalar is resolved again after substitution, so that e.g.
+		`ratio: ${RATIO}` is read as a number
+	*/
+
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		if rest := envReference.ReplaceAllString(node.Value, ""); strings.Contains(rest, "${") {
+			return fmt.Errorf("line %d: invalid environment variable reference in %q", node.Line, node.Value)
+		}
+
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(match string) string {
+			if match == "$$" {
+				return "$"
+			}
+			groups := envReference.FindStringSubmatch(match)
+			if value := os.Getenv(groups[1]); value != "" {
+				return value
+			}
+			return groups[2]
+		})
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+		return nil
+	}
+
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := substituteEnvNodes(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileParser validates a configuration file, and remembers the line of every value so that errors found while
+// resolving it can point at them
+type fileParser struct {
+	lines map[string]int
+}
+
+func checkFileFormat(doc *yaml.Node) error {
+	/*
+		check the version of the file before anything else, since the rest of it cannot be validated
+		against the shapes of another version
+	*/
+
+	if doc.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if key, value := doc.Content[i], doc.Content[i+1]; key.Value == "file_format" {
+				if !slices.Contains(supportedFileFormats, value.Value) {
+					return fmt.Errorf("line %d: file_format: unsupported version %q, must be one of %s",
+						value.Line, value.Value, strings.Join(supportedFileFormats, ", "))
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("file_format must be set to one of %s", strings.Join(supportedFileFormats, ", "))
+}
+
+func (p *fileParser) errorf(path string, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s: %s", p.lines[path], path, fmt.Sprintf(format, args...))
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (p *fileParser) check(node *yaml.Node, t reflect.Type, path string) error {
+	/*
+		check that `node` has the shape of `t`: mappings only contain the fields of the corresponding
+		struct, and scalars can be decoded into the corresponding type. an empty value for a struct,
+		such as `console:`, is treated as an empty mapping
+	*/
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	p.lines[path] = node.Line
+
+	isNull := node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if isNull {
+			node.Kind, node.Tag, node.Value = yaml.MappingNode, "!!map", ""
+			return nil
+		}
+		if node.Kind != yaml.MappingNode {
+			return p.errorf(path, "expected a mapping")
+		}
+
+		fields := make(map[string]reflect.Type, t.NumField())
+		names := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			fields[name] = t.Field(i).Type
+			names = append(names, name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				supported := strings.Join(names, ", ")
+				if path == "" {
+					return fmt.Errorf("line %d: unknown field %q, supported fields are %s", key.Line, key.Value, supported)
+				}
+				return fmt.Errorf("line %d: %s: unknown field %q, supported fields are %s",
+					key.Line, path, key.Value, supported)
+			}
+			if err := p.check(node.Content[i+1], fieldType, joinPath(path, key.Value)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if isNull {
+			return nil
+		}
+		if node.Kind != yaml.SequenceNode {
+			return p.errorf(path, "expected a list")
+		}
+		for i, item := range node.Content {
+			if err := p.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+	default:
+		if isNull {
+			return nil
+		}
+		if node.Kind != yaml.ScalarNode || node.Decode(reflect.New(t).Interface()) != nil {
+			return p.errorf(path, "expected %s, got %q", scalarTypeName(t), node.Value)
+		}
+	}
+
+	return nil
+}
+
+func scalarTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
+
+func (p *fileParser) resolve(fc *fileConfig) (*configFileSettings, error) {
+	/*
+		validate the decoded file, and resolve it into configFileSettings
+	*/
+
+	s := &configFileSettings{
+		env:        make(map[string]string),
+		processors: make(map[string]map[string]*processorSettings),
+	}
+
+	if fc.Disabled != nil {
+		s.env["OTEL_SDK_DISABLED"] = strconv.FormatBool(*fc.Disabled)
+	}
+	if fc.LogLevel != "" {
+		if _, ok := internalLogVerbosity[fc.LogLevel]; !ok {
+			return nil, p.errorf("log_level", "unsupported value %q, must be one of error, warn, info, debug", fc.LogLevel)
+		}
+		s.env["OTEL_LOG_LEVEL"] = fc.LogLevel
+	}
+
+	if fc.Resource != nil {
+		for i, attr := range fc.Resource.Attributes {
+			kv, err := p.resolveAttribute(fmt.Sprintf("resource.attributes[%d]", i), attr)
+			if err != nil {
+				return nil, err
+			}
+			if kv.Key == semconv.ServiceNameKey {
+				s.env["OTEL_SERVICE_NAME"] = kv.Value.Emit()
+			}
+			s.resourceAttributes = append(s.resourceAttributes, kv)
+		}
+	}
+
+	if fc.Propagator != nil {
+		for i, name := range fc.Propagator.Composite {
+			if _, err := newPropagators([]string{name}); err != nil {
+				return nil, p.errorf(fmt.Sprintf("propagator.composite[%d]", i), "%v", err)
+			}
+		}
+		s.env["OTEL_PROPAGATORS"] = cmp.Or(strings.Join(fc.Propagator.Composite, ","), "none")
+	}
+
+	if fc.TracerProvider != nil {
+		if err := p.resolveProcessors(s, "traces", "tracer_provider.processors", fc.TracerProvider.Processors); err != nil {
+			return nil, err
+		}
+		if fc.TracerProvider.Sampler != nil {
+			sampler, arg, err := p.resolveSampler("tracer_provider.sampler", fc.TracerProvider.Sampler)
+			if err != nil {
+				return nil, err
+			}
+			s.env["OTEL_TRACES_SAMPLER"], s.env["OTEL_TRACES_SAMPLER_ARG"] = sampler, arg
+		}
+	}
+
+	if fc.MeterProvider != nil {
+		if err := p.resolveReaders(s, fc.MeterProvider.Readers); err != nil {
+			return nil, err
+		}
+		for i, view := range fc.MeterProvider.Views {
+			v, err := p.resolveView(fmt.Sprintf("meter_provider.views[%d]", i), view)
+			if err != nil {
+				return nil, err
+			}
+			s.views = append(s.views, v)
+		}
+		if fc.MeterProvider.ExemplarFilter != "" {
+			if _, err := parseExemplarFilter(fc.MeterProvider.ExemplarFilter); err != nil {
+				return nil, p.errorf("meter_provider.exemplar_filter", "%v", err)
+			}
+			s.env["OTEL_METRICS_EXEMPLAR_FILTER"] = fc.MeterProvider.ExemplarFilter
+		}
+	}
+
+	if fc.LoggerProvider != nil {
+		if err := p.resolveProcessors(s, "logs", "logger_provider.processors", fc.LoggerProvider.Processors); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (p *fileParser) resolveAttribute(path string, attr fileAttribute) (attribute.KeyValue, error) {
+	/*
+		resolve a resource attribute. the type is inferred from the value unless set explicitly to one
+		of the types of the schema
+	*/
+
+	if attr.Name == "" {
+		return attribute.KeyValue{}, p.errorf(path, "name must be set")
+	}
+	key := attribute.Key(attr.Name)
+	valuePath := path + ".value"
+	if _, ok := p.lines[valuePath]; !ok {
+		valuePath = path
+	}
+
+	mismatch := func() (attribute.KeyValue, error) {
+		return attribute.KeyValue{}, p.errorf(valuePath, "value %v is not of type %s", attr.Value, attr.Type)
+	}
+
+	switch value := attr.Value.(type) {
+	case nil:
+		return attribute.KeyValue{}, p.errorf(path, "value must be set")
+	case []any:
+		switch attr.Type {
+		case "", "string_array":
+			values := make([]string, len(value))
+			for i, v := range value {
+				values[i] = fmt.Sprint(v)
+			}
+			return key.StringSlice(values), nil
+		case "bool_array":
+			values := make([]bool, len(value))
+			for i, v := range value {
+				b, ok := v.(bool)
+				if !ok {
+					return mismatch()
+				}
+				values[i] = b
+			}
+			return key.BoolSlice(values), nil
+		case "int_array":
+			values := make([]int64, len(value))
+			for i, v := range value {
+				n, ok := v.(int)
+				if !ok {
+					return mismatch()
+				}
+				values[i] = int64(n)
+			}
+			return key.Int64Slice(values), nil
+		case "double_array":
+			values := make([]float64, len(value))
+			for i, v := range value {
+				switch n := v.(type) {
+				case int:
+					values[i] = float64(n)
+				case float64:
+					values[i] = n
+				default:
+					return mismatch()
+				}
+			}
+			return key.Float64Slice(values), nil
+		}
+	case map[string]any:
+		return attribute.KeyValue{}, p.errorf(valuePath, "value must be a scalar or a list")
+	default:
+		switch attr.Type {
+		case "":
+			switch v := value.(type) {
+			case bool:
+				return key.Bool(v), nil
+			case int:
+				return key.Int(v), nil
+			case float64:
+				return key.Float64(v), nil
+			}
+			return key.String(fmt.Sprint(value)), nil
+		case "string":
+			return key.String(fmt.Sprint(value)), nil
+		case "bool":
+			if v, ok := value.(bool); ok {
+				return key.Bool(v), nil
+			}
+			return mismatch()
+		case "int":
+			if v, ok := value.(int); ok {
+				return key.Int(v), nil
+			}
+			return mismatch()
+		case "double":
+			switch v := value.(type) {
+			case int:
+				return key.Float64(float64(v)), nil
+			case float64:
+				return key.Float64(v), nil
+			}
+			return mismatch()
+		}
+	}
+
+	return attribute.KeyValue{}, p.errorf(path+".type",
+		"unsupported type %q, must be one of string, bool, int, double, string_array, bool_array, int_array, double_array",
+		attr.Type)
+}
+
+func (p *fileParser) resolveProcessors(
+	s *configFileSettings, signal string, path string, processors []fileProcessor,
+) error {
+	/*
+		resolve the span or log record processors of a provider into the exporters of `signal`. since
+		exporter settings are resolved per signal, each exporter type may only be used once
+	*/
+
+	s.processors[signal] = make(map[string]*processorSettings)
+
+	var exporters []string
+	for i, processor := range processors {
+		processorPath := fmt.Sprintf("%s[%d]", path, i)
+		settings := &processorSettings{}
+
+		var exporter *fileExporter
+		switch {
+		case processor.Batch != nil && processor.Simple != nil:
+			return p.errorf(processorPath, "only one of batch or simple may be set")
+		case processor.Batch != nil:
+			processorPath += ".batch"
+			batch := processor.Batch
+			for _, field := range []struct {
+				name  string
+				value *int
+			}{
+				{"schedule_delay", batch.ScheduleDelay},
+				{"export_timeout", batch.ExportTimeout},
+				{"max_queue_size", batch.MaxQueueSize},
+				{"max_export_batch_size", batch.MaxExportBatchSize},
+			} {
+				if field.value != nil && *field.value <= 0 {
+					return p.errorf(joinPath(processorPath, field.name), "must be a positive number, got %d", *field.value)
+				}
+			}
+			settings.scheduleDelay = milliseconds(batch.ScheduleDelay)
+			settings.exportTimeout = milliseconds(batch.ExportTimeout)
+			if batch.MaxQueueSize != nil {
+				settings.maxQueueSize = *batch.MaxQueueSize
+			}
+			if batch.MaxExportBatchSize != nil {
+				settings.maxExportBatchSize = *batch.MaxExportBatchSize
+			}
+			exporter = &batch.Exporter
+		case processor.Simple != nil:
+			processorPath += ".simple"
+			settings.simple = true
+			exporter = &processor.Simple.Exporter
+		default:
+			return p.errorf(processorPath, "one of batch or simple must be set")
+		}
+
+		exporterType, err := p.resolveExporter(s, signal, processorPath+".exporter", exporter)
+		if err != nil {
+			return err
+		}
+		if err := p.addExporter(s, signal, processorPath+".exporter", &exporters, exporterType, settings); err != nil {
+			return err
+		}
+	}
+
+	s.env[fmt.Sprintf("OTEL_%s_EXPORTER", strings.ToUpper(signal))] = exportersEnv(exporters)
+	return nil
+}
+
+func (p *fileParser) addExporter(
+	s *configFileSettings, signal string, path string, exporters *[]string, exporterType string, settings *processorSettings,
+) error {
+	canonical := exporterAliases[exporterType]
+	if _, ok := s.processors[signal][canonical]; ok {
+		return p.errorf(path, "the %s exporter is already configured for %s, each exporter may only be used once",
+			exporterType, signal)
+	}
+	s.processors[signal][canonical] = settings
+	*exporters = append(*exporters, exporterType)
+	return nil
+}
+
+func exportersEnv(exporters []string) string {
+	if len(exporters) == 0 {
+		return exporterNoop
+	}
+	return strings.Join(exporters, ",")
+}
+
+func milliseconds(value *int) time.Duration {
+	if value == nil {
+		return 0
+	}
+	return time.Duration(*value) * time.Millisecond
+}
+
+func (p *fileParser) resolveExporter(
+	s *configFileSettings, signal string, path string, exporter *fileExporter,
+) (string, error) {
+	/*
+		resolve the exporter of a processor or periodic reader into an exporter type, and keep its
+		settings as the per-signal OTEL_EXPORTER_OTLP_* variables
+	*/
+
+	var set []string
+	for name, value := range map[string]bool{
+		"otlp":    exporter.OTLP != nil,
+		"console": exporter.Console != nil,
+		"file":    exporter.File != nil,
+		"memory":  exporter.Memory != nil,
+	} {
+		if value {
+			set = append(set, name)
+		}
+	}
+	if len(set) != 1 {
+		slices.Sort(set)
+		return "", p.errorf(path, "exactly one of otlp, console, file or memory must be set, got [%s]",
+			strings.Join(set, ", "))
+	}
+	if exporter.OTLP == nil {
+		return set[0], nil
+	}
+
+	otlp := exporter.OTLP
+	path = path + ".otlp"
+	prefix := fmt.Sprintf("OTEL_EXPORTER_OTLP_%s_", strings.ToUpper(signal))
+
+	exporterType := "otlp"
+	switch otlp.Protocol {
+	case "", protocolGRPC:
+	case protocolHTTPProtobuf:
+		exporterType = "otlphttp"
+	default:
+		return "", p.errorf(path+".protocol", "unsupported protocol %q, must be one of %s or %s",
+			otlp.Protocol, protocolGRPC, protocolHTTPProtobuf)
+	}
+	s.env[prefix+"PROTOCOL"] = otlp.Protocol
+
+	if strings.Contains(otlp.Endpoint, "://") {
+		u, err := url.Parse(otlp.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return "", p.errorf(path+".endpoint", "invalid endpoint %q, must be a http or https URL or host:port", otlp.Endpoint)
+		}
+	}
+	s.env[prefix+"ENDPOINT"] = otlp.Endpoint
+
+	for _, file := range []struct {
+		name  string
+		value string
+	}{
+		{"certificate", otlp.Certificate},
+		{"client_certificate", otlp.ClientCertificate},
+		{"client_key", otlp.ClientKey},
+	} {
+		if file.value == "" {
+			continue
+		}
+		if _, err := os.Stat(file.value); err != nil {
+			return "", p.errorf(joinPath(path, file.name), "%v", err)
+		}
+	}
+	if (otlp.ClientCertificate == "") != (otlp.ClientKey == "") {
+		return "", p.errorf(path, "client_certificate and client_key must be set together")
+	}
+	s.env[prefix+"CERTIFICATE"] = otlp.Certificate
+	s.env[prefix+"CLIENT_CERTIFICATE"] = otlp.ClientCertificate
+	s.env[prefix+"CLIENT_KEY"] = otlp.ClientKey
+
+	headers := make([]string, 0, len(otlp.Headers)+1)
+	for i, header := range otlp.Headers {
+		if header.Name == "" {
+			return "", p.errorf(fmt.Sprintf("%s.headers[%d]", path, i), "name must be set")
+		}
+		headers = append(headers, header.Name+"="+url.PathEscape(header.Value))
+	}
+	if otlp.HeadersList != "" {
+		if _, err := parseOTLPHeaders(otlp.HeadersList); err != nil {
+			return "", p.errorf(path+".headers_list", "%v", err)
+		}
+		headers = append(headers, otlp.HeadersList)
+	}
+	s.env[prefix+"HEADERS"] = strings.Join(headers, ",")
+
+	if otlp.Compression != "" && otlp.Compression != compressionGzip && otlp.Compression != compressionNone {
+		return "", p.errorf(path+".compression", "unsupported compression %q, must be one of %s or %s",
+			otlp.Compression, compressionGzip, compressionNone)
+	}
+	s.env[prefix+"COMPRESSION"] = otlp.Compression
+
+	if otlp.Timeout != nil {
+		if *otlp.Timeout <= 0 {
+			return "", p.errorf(path+".timeout", "must be a positive number of milliseconds, got %d", *otlp.Timeout)
+		}
+		s.env[prefix+"TIMEOUT"] = strconv.Itoa(*otlp.Timeout)
+	}
+	if otlp.Insecure != nil {
+		s.env[prefix+"INSECURE"] = strconv.FormatBool(*otlp.Insecure)
+	}
+
+	if signal != "metrics" {
+		if otlp.TemporalityPreference != "" {
+			return "", p.errorf(path+".temporality_preference", "only supported by metric exporters")
+		}
+		if otlp.DefaultHistogramAggregation != "" {
+			return "", p.errorf(path+".default_histogram_aggregation", "only supported by metric exporters")
+		}
+		return exporterType, nil
+	}
+
+	if otlp.TemporalityPreference != "" {
+		if _, err := temporalitySelector(otlp.TemporalityPreference); err != nil {
+			return "", p.errorf(path+".temporality_preference", "%v", err)
+		}
+		s.env[prefix+"TEMPORALITY_PREFERENCE"] = otlp.TemporalityPreference
+	}
+	if otlp.DefaultHistogramAggregation != "" {
+		if _, err := histogramAggregationSelector(otlp.DefaultHistogramAggregation); err != nil {
+			return "", p.errorf(path+".default_histogram_aggregation", "%v", err)
+		}
+		s.env[prefix+"DEFAULT_HISTOGRAM_AGGREGATION"] = otlp.DefaultHistogramAggregation
+	}
+
+	return exporterType, nil
+}
+
+func (p *fileParser) resolveSampler(path string, sampler *fileSampler) (string, string, error) {
+	/*
+		resolve a sampler into the values of OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG. only the
+		samplers that can be expressed that way are supported
+	*/
+
+	var set []string
+	for name, value := range map[string]bool{
+		"always_on":            sampler.AlwaysOn != nil,
+		"always_off":           sampler.AlwaysOff != nil,
+		"trace_id_ratio_based": sampler.TraceIDRatioBased != nil,
+		"parent_based":         sampler.ParentBased != nil,
+	} {
+		if value {
+			set = append(set, name)
+		}
+	}
+	if len(set) != 1 {
+		slices.Sort(set)
+		return "", "", p.errorf(path,
+			"exactly one of always_on, always_off, trace_id_ratio_based or parent_based must be set, got [%s]",
+			strings.Join(set, ", "))
+	}
+
+	switch {
+	case sampler.AlwaysOn != nil:
+		return samplerAlwaysOn, "", nil
+	case sampler.AlwaysOff != nil:
+		return samplerAlwaysOff, "", nil
+	case sampler.TraceIDRatioBased != nil:
+		ratio := sampler.TraceIDRatioBased.Ratio
+		if ratio == nil {
+			return samplerTraceIDRatio, "", nil
+		}
+		if *ratio < 0 || *ratio > 1 {
+			return "", "", p.errorf(path+".trace_id_ratio_based.ratio", "must be between 0 and 1, got %v", *ratio)
+		}
+		return samplerTraceIDRatio, strconv.FormatFloat(*ratio, 'f', -1, 64), nil
+	}
+
+	root := sampler.ParentBased.Root
+	if root == nil {
+		return samplerParentBasedAlwaysOn, "", nil
+	}
+	if root.ParentBased != nil {
+		return "", "", p.errorf(path+".parent_based.root.parent_based", "parent_based samplers may not be nested")
+	}
+	name, arg, err := p.resolveSampler(path+".parent_based.root", root)
+	if err != nil {
+		return "", "", err
+	}
+	return "parentbased_" + name, arg, nil
+}
+
+func (p *fileParser) resolveReaders(s *configFileSettings, readers []fileMetricReader) error {
+	/*
+		resolve the metric readers into the exporters of the metrics signal. a periodic reader pushes
+		to an exporter, while a pull reader is scraped by Prometheus or read from memory
+	*/
+
+	s.processors["metrics"] = make(map[string]*processorSettings)
+
+	var exporters []string
+	for i, reader := range readers {
+		path := fmt.Sprintf("meter_provider.readers[%d]", i)
+		switch {
+		case reader.Periodic != nil && reader.Pull != nil:
+			return p.errorf(path, "only one of periodic or pull may be set")
+		case reader.Periodic != nil:
+			path += ".periodic"
+			periodic := reader.Periodic
+			if periodic.Interval != nil && *periodic.Interval <= 0 {
+				return p.errorf(path+".interval", "must be a positive number, got %d", *periodic.Interval)
+			}
+			if periodic.Timeout != nil && *periodic.Timeout <= 0 {
+				return p.errorf(path+".timeout", "must be a positive number, got %d", *periodic.Timeout)
+			}
+			if periodic.Exporter.Memory != nil {
+				return p.errorf(path+".exporter.memory", "the memory exporter must be used with a pull reader")
+			}
+
+			exporterType, err := p.resolveExporter(s, "metrics", path+".exporter", &periodic.Exporter)
+			if err != nil {
+				return err
+			}
+			settings := &processorSettings{
+				scheduleDelay: milliseconds(periodic.Interval),
+				exportTimeout: milliseconds(periodic.Timeout),
+			}
+			if err := p.addExporter(s, "metrics", path+".exporter", &exporters, exporterType, settings); err != nil {
+				return err
+			}
+		case reader.Pull != nil:
+			path += ".pull.exporter"
+			exporter := reader.Pull.Exporter
+			var exporterType string
+			switch {
+			case exporter.Prometheus != nil && exporter.Memory != nil:
+				return p.errorf(path, "only one of prometheus or memory may be set")
+			case exporter.Prometheus != nil:
+				exporterType = exporterPrometheus
+				if port := exporter.Prometheus.Port; port != nil {
+					if *port <= 0 || *port > 65535 {
+						return p.errorf(path+".prometheus.port", "invalid port %d", *port)
+					}
+					s.env["ADMIN_PORT"] = strconv.Itoa(*port)
+				}
+			case exporter.Memory != nil:
+				exporterType = exporterMemory
+			default:
+				return p.errorf(path, "one of prometheus or memory must be set")
+			}
+			if err := p.addExporter(s, "metrics", path, &exporters, exporterType, &processorSettings{}); err != nil {
+				return err
+			}
+		default:
+			return p.errorf(path, "one of periodic or pull must be set")
+		}
+	}
+
+	s.env["OTEL_METRICS_EXPORTER"] = exportersEnv(exporters)
+	return nil
+}
+
+// instrumentKinds maps the instrument types of the schema to the instrument kinds of the SDK
+var instrumentKinds = map[string]sdkmetric.InstrumentKind{
+	"counter":                    sdkmetric.InstrumentKindCounter,
+	"up_down_counter":            sdkmetric.InstrumentKindUpDownCounter,
+	"histogram":                  sdkmetric.InstrumentKindHistogram,
+	"observable_counter":         sdkmetric.InstrumentKindObservableCounter,
+	"observable_up_down_counter": sdkmetric.InstrumentKindObservableUpDownCounter,
+	"observable_gauge":           sdkmetric.InstrumentKindObservableGauge,
+}
+
+func (p *fileParser) resolveView(path string, view fileView) (sdkmetric.View, error) {
+	/*
+		resolve a view, which changes the name, description, aggregation or attributes of the streams
+		of the instruments matched by its selector
+	*/
+
+	selector := view.Selector
+	criteria := sdkmetric.Instrument{
+		Name: selector.InstrumentName,
+		Unit: selector.Unit,
+		Scope: instrumentation.Scope{
+			Name:      selector.MeterName,
+			Version:   selector.MeterVersion,
+			SchemaURL: selector.MeterSchemaURL,
+		},
+	}
+	if selector.InstrumentType != "" {
+		kind, ok := instrumentKinds[selector.InstrumentType]
+		if !ok {
+			kinds := make([]string, 0, len(instrumentKinds))
+			for name := range instrumentKinds {
+				kinds = append(kinds, name)
+			}
+			slices.Sort(kinds)
+			return nil, p.errorf(path+".selector.instrument_type", "unsupported type %q, must be one of %s",
+				selector.InstrumentType, strings.Join(kinds, ", "))
+		}
+		criteria.Kind = kind
+	}
+	if criteria.Name == "" && criteria.Kind == 0 && criteria.Unit == "" && criteria.Scope == (instrumentation.Scope{}) {
+		return nil, p.errorf(path+".selector", "at least one criterion must be set")
+	}
+
+	stream := view.Stream
+	if stream.Name != "" && strings.ContainsAny(criteria.Name, "*?") {
+		return nil, p.errorf(path+".stream.name", "may not be set when instrument_name contains a wildcard")
+	}
+	mask := sdkmetric.Stream{Name: stream.Name, Description: stream.Description}
+
+	if stream.Aggregation != nil {
+		aggregation, err := p.resolveAggregation(path+".stream.aggregation", stream.Aggregation)
+		if err != nil {
+			return nil, err
+		}
+		mask.Aggregation = aggregation
+	}
+
+	if keys := stream.AttributeKeys; keys != nil {
+		if keys.Included != nil && keys.Excluded != nil {
+			return nil, p.errorf(path+".stream.attribute_keys", "only one of included or excluded may be set")
+		}
+		toKeys := func(names []string) []attribute.Key {
+			keys := make([]attribute.Key, len(names))
+			for i, name := range names {
+				keys[i] = attribute.Key(name)
+			}
+			return keys
+		}
+		if keys.Included != nil {
+			mask.AttributeFilter = attribute.NewAllowKeysFilter(toKeys(keys.Included)...)
+		} else {
+			mask.AttributeFilter = attribute.NewDenyKeysFilter(toKeys(keys.Excluded)...)
+		}
+	}
+
+	return sdkmetric.NewView(criteria, mask), nil
+}
+
+func (p *fileParser) resolveAggregation(path string, aggregation *fileAggregation) (sdkmetric.Aggregation, error) {
+	var set []string
+	for name, value := range map[string]bool{
+		"default":                            aggregation.Default != nil,
+		"drop":                               aggregation.Drop != nil,
+		"sum":                                aggregation.Sum != nil,
+		"last_value":                         aggregation.LastValue != nil,
+		"explicit_bucket_histogram":          aggregation.ExplicitBucketHistogram != nil,
+		"base2_exponential_bucket_histogram": aggregation.Base2ExponentialBucketHistogram != nil,
+	} {
+		if value {
+			set = append(set, name)
+		}
+	}
+	if len(set) != 1 {
+		slices.Sort(set)
+		return nil, p.errorf(path, "exactly one aggregation must be set, got [%s]", strings.Join(set, ", "))
+	}
+
+	switch {
+	case aggregation.Default != nil:
+		return sdkmetric.AggregationDefault{}, nil
+	case aggregation.Drop != nil:
+		return sdkmetric.AggregationDrop{}, nil
+	case aggregation.Sum != nil:
+		return sdkmetric.AggregationSum{}, nil
+	case aggregation.LastValue != nil:
+		return sdkmetric.AggregationLastValue{}, nil
+	case aggregation.ExplicitBucketHistogram != nil:
+		histogram := aggregation.ExplicitBucketHistogram
+		result := sdkmetric.AggregationExplicitBucketHistogram{
+			Boundaries: histogram.Boundaries,
+			NoMinMax:   histogram.RecordMinMax != nil && !*histogram.RecordMinMax,
+		}
+		if histogram.Boundaries == nil {
+			result.Boundaries = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+		}
+		for i := 1; i < len(result.Boundaries); i++ {
+			if result.Boundaries[i] <= result.Boundaries[i-1] {
+				return nil, p.errorf(path+".explicit_bucket_histogram.boundaries", "must be in increasing order")
+			}
+		}
+		return result, nil
+	}
+
+	histogram := aggregation.Base2ExponentialBucketHistogram
+	result := sdkmetric.AggregationBase2ExponentialHistogram{
+		MaxSize:  160,
+		MaxScale: 20,
+		NoMinMax: histogram.RecordMinMax != nil && !*histogram.RecordMinMax,
+	}
+	if histogram.MaxSize != nil {
+		result.MaxSize = *histogram.MaxSize
+	}
+	if histogram.MaxScale != nil {
+		result.MaxScale = *histogram.MaxScale
+	}
+	path += ".base2_exponential_bucket_histogram"
+	if result.MaxSize <= 0 {
+		return nil, p.errorf(path+".max_size", "must be a positive number, got %d", result.MaxSize)
+	}
+	if result.MaxScale < -10 || result.MaxScale > 20 {
+		return nil, p.errorf(path+".max_scale", "must be between -10 and 20, got %d", result.MaxScale)
+	}
+	return result, nil
+}
@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseConfigFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "empty",
+			file:    "",
+			wantErr: "file is empty",
+		},
+		{
+			name:    "missing file_format",
+			file:    "disabled: false\n",
+			wantErr: "file_format must be set to one of 0.3",
+		},
+		{
+			name:    "unsupported file_format",
+			file:    "file_format: \"0.1\"\n",
+			wantErr: `line 1: file_format: unsupported version "0.1", must be one of 0.3`,
+		},
+		{
+			name: "unknown field",
+			file: "file_format: \"0.3\"\ntracer: {}\n",
+			wantErr: `line 2: unknown field "tracer", supported fields are file_format, disabled, log_level, ` +
+				"resource, propagator, tracer_provider, meter_provider, logger_provider",
+		},
+		{
+			name: "unknown nested field",
+			file: "file_format: \"0.3\"\ntracer_provider:\n  sampler:\n    always: {}\n",
+			wantErr: `line 4: tracer_provider.sampler: unknown field "always", supported fields are always_on, ` +
+				"always_off, trace_id_ratio_based, parent_based",
+		},
+		{
+			name:    "scalar instead of a boolean",
+			file:    "file_format: \"0.3\"\ndisabled: maybe\n",
+			wantErr: `line 2: disabled: expected a boolean, got "maybe"`,
+		},
+		{
+			name:    "list instead of a mapping",
+			file:    "file_format: \"0.3\"\nresource: [service.name]\n",
+			wantErr: "line 2: resource: expected a mapping",
+		},
+		{
+			name:    "scalar instead of a list",
+			file:    "file_format: \"0.3\"\npropagator:\n  composite: tracecontext\n",
+			wantErr: "line 3: propagator.composite: expected a list",
+		},
+		{
+			name: "string instead of a number",
+			file: "file_format: \"0.3\"\ntracer_provider:\n  sampler:\n    trace_id_ratio_based:\n" +
+				"      ratio: half\n",
+			wantErr: `line 5: tracer_provider.sampler.trace_id_ratio_based.ratio: expected a number, got "half"`,
+		},
+		{
+			name:    "unsupported value",
+			file:    "file_format: \"0.3\"\nlog_level: verbose\n",
+			wantErr: `line 2: log_level: unsupported value "verbose", must be one of error, warn, info, debug`,
+		},
+		{
+			name:    "invalid environment variable reference",
+			file:    "file_format: \"0.3\"\nlog_level: ${LOG_LEVEL\n",
+			wantErr: `line 2: invalid environment variable reference in "${LOG_LEVEL"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseConfigFile([]byte(tc.file))
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("parseConfigFile returned %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConfigFileSubstitution(t *testing.T) {
+	t.Setenv("TEST_LOG_LEVEL", "debug")
+	t.Setenv("TEST_RATIO", "0.25")
+	t.Setenv("TEST_UNSET", "")
+	os.Unsetenv("TEST_UNSET")
+
+	for _, tc := range []struct {
+		name  string
+		file  string
+		env   string
+		value string
+	}{
+		{name: "variable", file: "log_level: ${TEST_LOG_LEVEL}", env: "OTEL_LOG_LEVEL", value: "debug"},
+		{name: "env prefix", file: "log_level: ${env:TEST_LOG_LEVEL}", env: "OTEL_LOG_LEVEL", value: "debug"},
+		{name: "unset variable with default", file: "log_level: ${TEST_UNSET:-warn}", env: "OTEL_LOG_LEVEL", value: "warn"},
+		{name: "set variable with default", file: "log_level: ${TEST_LOG_LEVEL:-warn}", env: "OTEL_LOG_LEVEL", value: "debug"},
+		{
+			name:  "number",
+			file:  "tracer_provider:\n  sampler:\n    trace_id_ratio_based:\n      ratio: ${TEST_RATIO}",
+			env:   "OTEL_TRACES_SAMPLER_ARG",
+			value: "0.25",
+		},
+		{
+			name:  "escaped",
+			file:  "resource:\n  attributes:\n    - name: service.name\n      value: $${TEST_LOG_LEVEL}",
+			env:   "OTEL_SERVICE_NAME",
+			value: "${TEST_LOG_LEVEL}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			settings, err := parseConfigFile([]byte("file_format: \"0.3\"\n" + tc.file + "\n"))
+			if err != nil {
+				t.Fatalf("parseConfigFile failed: %v", err)
+			}
+			if got := settings.env[tc.env]; got != tc.value {
+				t.Errorf("%s = %q, want %q", tc.env, got, tc.value)
+			}
+		})
+	}
+}
+
+func useConfigFile(t *testing.T, contents string) {
+	/*
+		point OTEL_CONFIG_FILE at a file with `contents`, and load it again on next use
+	*/
+
+	path := filepath.Join(t.TempDir(), "otel.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	t.Setenv("OTEL_CONFIG_FILE", path)
+
+	reset := func() {
+		configFileState.once = sync.Once{}
+		configFileState.settings, configFileState.err = nil, nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	file := `file_format: "0.3"
+resource:
+  attributes:
+    - name: service.name
+      value: from-file
+tracer_provider:
+  sampler:
+    always_off:
+`
+
+	for _, tc := range []struct {
+		name        string
+		env         string
+		opts        []Option
+		wantService string
+		wantSampler string
+	}{
+		{name: "file", wantService: "from-file", wantSampler: samplerAlwaysOff},
+		{name: "env", env: "from-env", wantService: "from-env", wantSampler: samplerTraceIDRatio},
+		{
+			name:        "option",
+			env:         "from-env",
+			opts:        []Option{WithServiceName("from-option"), WithTracesSampler(samplerAlwaysOn, "")},
+			wantService: "from-option",
+			wantSampler: samplerAlwaysOn,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			useConfigFile(t, file)
+			t.Setenv("OTEL_SERVICE_NAME", tc.env)
+			t.Setenv("OTEL_TRACES_SAMPLER", "")
+			if tc.env != "" {
+				t.Setenv("OTEL_TRACES_SAMPLER", samplerTraceIDRatio)
+			}
+
+			cfg, err := newConfig(tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to resolve config: %v", err)
+			}
+			if cfg.serviceName != tc.wantService {
+				t.Errorf("service name = %q, want %q", cfg.serviceName, tc.wantService)
+			}
+			if cfg.sampler != tc.wantSampler {
+				t.Errorf("sampler = %q, want %q", cfg.sampler, tc.wantSampler)
+			}
+		})
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	useConfigFile(t, "file_format: \"0.3\"\nlog_level: verbose\n")
+
+	_, err := newConfig()
+	if err == nil || !strings.Contains(err.Error(), `invalid OTEL_CONFIG_FILE`) ||
+		!strings.Contains(err.Error(), `line 2: log_level: unsupported value "verbose"`) {
+		t.Errorf("newConfig returned %v, want an error naming the file and the offending line", err)
+	}
+}
@@ -0,0 +1,273 @@
+package telemetry
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// canonical exporter types understood by newSpanExporter, newMetricExporter and newLogExporter. the prometheus
+// exporter is only supported for metrics
+const (
+	exporterOTLP       = "otel"
+	exporterOTLPHTTP   = "otlphttp"
+	exporterStdout     = "stdout"
+	exporterFile       = "file"
+	exporterMemory     = "memory"
+	exporterPrometheus = "prometheus"
+	exporterNoop       = "noop"
+)
+
+// exporterAliases maps the values defined by the OpenTelemetry SDK environment variable specification,
+// as well as the values historically used by this repository, to a canonical exporter type
+var exporterAliases = map[string]string{
+	"otlp":       exporterOTLP,
+	"otel":       exporterOTLP,
+	"otlphttp":   exporterOTLPHTTP,
+	"console":    exporterStdout,
+	"logging":    exporterStdout,
+	"stdout":     exporterStdout,
+	"file":       exporterFile,
+	"memory":     exporterMemory,
+	"prometheus": exporterPrometheus,
+	"none":       exporterNoop,
+	"noop":       exporterNoop,
+}
+
+func lookupEnv(name string, deprecatedName string) string {
+	/*
+		return the value of the environment variable `name`, falling back to `deprecatedName` if it is
+		unset. when the deprecated variable is used, or when both are set to different values, log which
+		of the two was chosen
+	*/
+
+	value, ok := os.LookupEnv(name)
+	deprecatedValue, deprecatedOk := os.LookupEnv(deprecatedName)
+
+	switch {
+	case ok && deprecatedOk && value != deprecatedValue:
+		log.Printf(
+			"telemetry: both %s=%q and deprecated %s=%q are set, using %s=%q\n",
+			name, value, deprecatedName, deprecatedValue, name, value,
+		)
+	case !ok && deprecatedOk:
+		log.Printf(
+			"telemetry: %s is deprecated, use %s instead. using %s=%q\n",
+			deprecatedName, name, deprecatedName, deprecatedValue,
+		)
+		return deprecatedValue
+	}
+
+	return value
+}
+
+func ServiceNameFromEnv() string {
+	/*
+		resolve the service name from the environment. OTEL_SERVICE_NAME takes precedence over the
+		deprecated SERVICE_NAME variable, which in turn takes precedence over a `service.name` entry
+		in OTEL_RESOURCE_ATTRIBUTES and then in the resource of the configuration file
+	*/
+
+	if name := lookupEnv("OTEL_SERVICE_NAME", "SERVICE_NAME"); name != "" {
+		return name
+	}
+
+	envResource, err := resource.New(context.Background(), resource.WithFromEnv())
+	if err != nil {
+		log.Printf("telemetry: failed to parse OTEL_RESOURCE_ATTRIBUTES: %v\n", err)
+	}
+	if envResource != nil {
+		if name, ok := envResource.Set().Value(semconv.ServiceNameKey); ok {
+			return name.AsString()
+		}
+	}
+
+	if _, err := loadedConfigFile(); err != nil {
+		// Init reports the error as well, but a caller that requires a service name may give up first
+		log.Printf("telemetry: %v\n", err)
+	}
+	return configFileEnv("OTEL_SERVICE_NAME")
+}
+
+func exportersFromEnv(signal string) []string {
+	/*
+		read the exporters of `signal` from OTEL_<SIGNAL>_EXPORTER, its deprecated alias <SIGNAL>_EXPORTER,
+		or the configuration file, in that order
+	*/
+
+	name := strings.ToUpper(signal) + "_EXPORTER"
+	return []string{cmp.Or(lookupEnv("OTEL_"+name, name), configFileEnv("OTEL_"+name))}
+}
+
+func propagatorsFromEnv() ([]propagation.TextMapPropagator, error) {
+	/*
+		resolve the propagators listed in OTEL_PROPAGATORS, a comma separated list such as
+		`tracecontext,baggage,b3`. defaults to `tracecontext,baggage`
+	*/
+
+	names := defaultPropagators
+	if value := getenv("OTEL_PROPAGATORS"); value != "" {
+		names = strings.Split(value, ",")
+	}
+
+	propagators, err := newPropagators(names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_PROPAGATORS: %w", err)
+	}
+	return propagators, nil
+}
+
+func sdkDisabledFromEnv() bool {
+	/*
+		report whether OTEL_SDK_DISABLED, or `disabled` in the configuration file, is `true`
+		(case-insensitive). any other value, including an empty one, leaves the SDK enabled
+	*/
+
+	return strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true")
+}
+
+func normalizeExporter(signal string, exporterType string) string {
+	/*
+		map `exporterType` to one of the canonical exporter types. an empty value selects the noop
+		exporter, so that services which do not configure a signal keep exporting nothing rather than
+		the OTLP default from the specification. unrecognized values are logged and treated as noop
+	*/
+
+	exporterType = strings.ToLower(strings.TrimSpace(exporterType))
+	if exporterType == "" {
+		return exporterNoop
+	}
+
+	canonical, ok := exporterAliases[exporterType]
+	if !ok {
+		log.Printf("telemetry: unrecognized %s exporter %q, it will be ignored\n", signal, exporterType)
+		return exporterNoop
+	}
+	if canonical == exporterPrometheus && signal != "metrics" {
+		log.Printf("telemetry: the %s exporter only supports metrics, it will be ignored for %s\n", canonical, signal)
+		return exporterNoop
+	}
+
+	return canonical
+}
+
+func normalizeExporters(signal string, exporterTypes []string) []string {
+	/*
+		split each of `exporterTypes` on commas, e.g. `otel,stdout`, and map every entry to its canonical
+		exporter type. duplicates are removed, and noop entries are dropped when any other exporter is
+		configured. if nothing remains, the noop exporter is selected
+	*/
+
+	var exporters []string
+	for _, value := range exporterTypes {
+		for _, exporterType := range strings.Split(value, ",") {
+			canonical := normalizeExporter(signal, exporterType)
+			if canonical == exporterNoop || slices.Contains(exporters, canonical) {
+				continue
+			}
+			exporters = append(exporters, canonical)
+		}
+	}
+
+	if len(exporters) == 0 {
+		return []string{exporterNoop}
+	}
+	return exporters
+}
+
+func (cfg *config) applyEnv() {
+	/*
+		fill in any value that was not set through an Option from the standard OTEL_* environment
+		variables, accepting the variables previously used by this repository as deprecated aliases.
+		values that are not set in the environment either are taken from the configuration file
+	*/
+
+	if cfg.serviceName == "" {
+		cfg.serviceName = ServiceNameFromEnv()
+	}
+	if len(cfg.tracesExporters) == 0 {
+		cfg.tracesExporters = exportersFromEnv("traces")
+	}
+	if len(cfg.metricsExporters) == 0 {
+		cfg.metricsExporters = exportersFromEnv("metrics")
+	}
+	if len(cfg.logsExporters) == 0 {
+		cfg.logsExporters = exportersFromEnv("logs")
+	}
+	if cfg.sampler == "" {
+		cfg.sampler = getenv("OTEL_TRACES_SAMPLER")
+		cfg.samplerArg = getenv("OTEL_TRACES_SAMPLER_ARG")
+	}
+	if cfg.routeRatios == nil {
+		if value := os.Getenv("TRACES_SAMPLER_ROUTES"); value != "" {
+			cfg.routeRatios = parseRouteRatios(value)
+		}
+	}
+	if cfg.baggage == nil {
+		cfg.baggage = parseBaggageSettings(
+			os.Getenv("BAGGAGE_ATTRIBUTES"),
+			os.Getenv("BAGGAGE_ATTRIBUTES_MAX_LENGTH"),
+			os.Getenv("BAGGAGE_ATTRIBUTES_PREFIX"),
+		)
+	}
+	if cfg.redactionRulesFile == "" {
+		cfg.redactionRulesFile = strings.TrimSpace(os.Getenv("REDACTION_RULES_FILE"))
+	}
+	if cfg.exemplarFilter == "" {
+		cfg.exemplarFilter = getenv("OTEL_METRICS_EXEMPLAR_FILTER")
+	}
+	if cfg.exemplarEnv == nil {
+		cfg.exemplarEnv = envBool("EXEMPLAR_ENV_ENABLED", false)
+	}
+	if cfg.runtimeMetrics == nil {
+		cfg.runtimeMetrics = envBool("RUNTIME_METRICS_ENABLED", true)
+	}
+	if cfg.processMetrics == nil {
+		cfg.processMetrics = envBool("PROCESS_METRICS_ENABLED", true)
+	}
+	if !cfg.samplerDebug {
+		cfg.samplerDebug = strings.EqualFold(strings.TrimSpace(os.Getenv("TRACES_SAMPLER_DEBUG")), "true")
+	}
+	if cfg.exportBufferSignals == nil {
+		if value := os.Getenv("EXPORT_BUFFER_SIGNALS"); value != "" {
+			cfg.exportBufferSignals = strings.Split(value, ",")
+		}
+	}
+	if cfg.adminPort == "" {
+		cfg.adminPort = getenv("ADMIN_PORT")
+	}
+	if cfg.adminPort == "" {
+		cfg.adminPort = defaultAdminPort
+	}
+	if cfg.adminToken == "" {
+		cfg.adminToken = strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+	}
+	cfg.logLevel = strings.ToLower(getenv("OTEL_LOG_LEVEL"))
+	cfg.disabled = sdkDisabledFromEnv()
+
+	cfg.tracesExporters = normalizeExporters("traces", cfg.tracesExporters)
+	cfg.metricsExporters = normalizeExporters("metrics", cfg.metricsExporters)
+	cfg.logsExporters = normalizeExporters("logs", cfg.logsExporters)
+	cfg.sampler = strings.ToLower(strings.TrimSpace(cfg.sampler))
+}
+
+func (cfg *config) exportBufferEnabled(signal string) bool {
+	/*
+		report whether failed OTLP exports of `signal` should be buffered on disk
+	*/
+
+	for _, s := range cfg.exportBufferSignals {
+		if strings.EqualFold(strings.TrimSpace(s), signal) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,544 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/metric"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultExportBufferDir       = "telemetry-buffer"
+	defaultExportBufferMaxSizeMB = 64
+	// exportBufferReplayInterval is how often buffered batches are retried while nothing new is exported
+	exportBufferReplayInterval = 5 * time.Second
+	exportBufferFileSuffix     = ".otlp"
+)
+
+// exportBufferSettings describes where failed export batches of a single signal are kept, and how much space
+// they may take up
+type exportBufferSettings struct {
+	dir      string
+	maxBytes int64
+}
+
+func resolveExportBufferSettings(signal string) *exportBufferSettings {
+	/*
+		resolve the buffer settings for `signal`. batches are kept in a subdirectory of
+		EXPORT_BUFFER_DIR named after the signal, and each signal may use up to
+		EXPORT_BUFFER_MAX_SIZE_MB
+	*/
+
+	dir := strings.TrimSpace(os.Getenv("EXPORT_BUFFER_DIR"))
+	if dir == "" {
+		dir = defaultExportBufferDir
+	}
+
+	return &exportBufferSettings{
+		dir:      filepath.Join(dir, signal),
+		maxBytes: int64(envInt("EXPORT_BUFFER_MAX_SIZE_MB", defaultExportBufferMaxSizeMB)) << 20,
+	}
+}
+
+// exportBufferInstruments are shared by the buffers of all signals, which are told apart by the `signal`
+// attribute. they are created on the global meter provider, which is registered after the exporters are
+var exportBufferInstruments struct {
+	once     sync.Once
+	err      error
+	replayed metric.Int64Counter
+	dropped  metric.Int64Counter
+
+	mu      sync.Mutex
+	buffers map[*exportBuffer]struct{}
+}
+
+func initExportBufferInstruments() error {
+	exportBufferInstruments.once.Do(func() {
+		meter := otel.Meter(instrumentationName)
+		exportBufferInstruments.buffers = make(map[*exportBuffer]struct{})
+
+		var err error
+		if exportBufferInstruments.replayed, err = meter.Int64Counter("telemetry.export_buffer.replayed",
+			metric.WithDescription("The number of buffered export batches that were delivered"),
+			metric.WithUnit("{batch}"),
+		); err != nil {
+			exportBufferInstruments.err = err
+			return
+		}
+		if exportBufferInstruments.dropped, err = meter.Int64Counter("telemetry.export_buffer.dropped",
+			metric.WithDescription("The number of export batches dropped because the buffer was full or unreadable, "+
+				"or because the endpoint rejected them permanently"),
+			metric.WithUnit("{batch}"),
+		); err != nil {
+			exportBufferInstruments.err = err
+			return
+		}
+		_, exportBufferInstruments.err = meter.Int64ObservableUpDownCounter("telemetry.export_buffer.size",
+			metric.WithDescription("The size of the export batches currently buffered on disk"),
+			metric.WithUnit("By"),
+			metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+				exportBufferInstruments.mu.Lock()
+				defer exportBufferInstruments.mu.Unlock()
+				for b := range exportBufferInstruments.buffers {
+					o.Observe(b.size.Load(), b.attrs)
+				}
+				return nil
+			}),
+		)
+	})
+
+	return exportBufferInstruments.err
+}
+
+type bufferedBatch struct {
+	path string
+	size int64
+}
+
+// errReplayInProgress is returned by replayBatches when the buffered batches are already being replayed
+var errReplayInProgress = errors.New("earlier batches are being replayed")
+
+// exportBuffer is a write-ahead buffer for export batches that could not be delivered. batches are written to
+// disk in the order they failed and replayed in that order once the endpoint accepts exports again, either
+// ahead of the next export or periodically in the background. once the buffer is full, the oldest batches are
+// dropped to make room. mu guards the list of batches, and is not held while a batch is sent
+type exportBuffer struct {
+	mu       sync.Mutex
+	signal   string
+	settings *exportBufferSettings
+	replay   func(ctx context.Context, payload []byte) error
+	batches  []bufferedBatch
+	sequence uint64
+	// replaying is set while a single caller replays the buffered batches, so that others do not wait for it
+	replaying bool
+	// size is only modified while holding mu, but may be read at any time by the metric callback
+	size atomic.Int64
+
+	attrs metric.MeasurementOption
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newExportBuffer(
+	signal string, settings *exportBufferSettings, replay func(ctx context.Context, payload []byte) error,
+) *exportBuffer {
+	return &exportBuffer{
+		signal:   signal,
+		settings: settings,
+		replay:   replay,
+		attrs:    metric.WithAttributeSet(attribute.NewSet(attribute.String("signal", signal))),
+	}
+}
+
+func (b *exportBuffer) Start() error {
+	/*
+		load batches left over from a previous run, register the buffer metrics and start replaying in
+		the background
+	*/
+
+	if err := b.load(); err != nil {
+		return fmt.Errorf("failed to open export buffer for %s: %w", b.signal, err)
+	}
+
+	if err := initExportBufferInstruments(); err != nil {
+		return fmt.Errorf("failed to create export buffer metrics: %w", err)
+	}
+	exportBufferInstruments.mu.Lock()
+	exportBufferInstruments.buffers[b] = struct{}{}
+	exportBufferInstruments.mu.Unlock()
+
+	b.stop, b.done = make(chan struct{}), make(chan struct{})
+	go b.run()
+
+	if len(b.batches) > 0 {
+		log.Printf("telemetry: %d %s batches (%d bytes) buffered by a previous run will be replayed\n",
+			len(b.batches), b.signal, b.size.Load())
+	}
+	return nil
+}
+
+func (b *exportBuffer) Stop() {
+	/*
+		stop replaying in the background. batches still buffered stay on disk, and are replayed by the
+		next process that uses the same directory
+	*/
+
+	if b.stop == nil {
+		return
+	}
+	close(b.stop)
+	<-b.done
+	b.stop = nil
+
+	exportBufferInstruments.mu.Lock()
+	delete(exportBufferInstruments.buffers, b)
+	exportBufferInstruments.mu.Unlock()
+}
+
+func (b *exportBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(exportBufferReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			_ = b.replayBatches(context.Background())
+		}
+	}
+}
+
+func (b *exportBuffer) load() error {
+	if err := os.MkdirAll(b.settings.dir, 0o755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(b.settings.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(b.settings.dir, name)
+		if !strings.HasSuffix(name, exportBufferFileSuffix) {
+			// a batch that was being written when the previous process exited
+			_ = os.Remove(path)
+			continue
+		}
+
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, exportBufferFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		b.batches = append(b.batches, bufferedBatch{path: path, size: info.Size()})
+		b.size.Add(info.Size())
+		b.sequence = sequence + 1
+	}
+
+	return nil
+}
+
+func (b *exportBuffer) Upload(ctx context.Context, msg proto.Message, send func(ctx context.Context) error) error {
+	/*
+		send a batch, buffering it on disk if that fails in a way that may succeed later. batches
+		buffered earlier are replayed first, and while any remain buffered new batches are appended
+		behind them, so that the endpoint always receives batches in the order they were exported. a
+		batch the endpoint rejects permanently is dropped rather than buffered. an error is still
+		returned for a batch that was buffered or dropped, so that the failed export is reported. while
+		the buffered batches are replayed in the background, the batch is buffered behind them rather
+		than waiting for the replay to end
+	*/
+
+	err := b.replayBatches(ctx)
+	if err == nil {
+		if err = send(ctx); err == nil {
+			return nil
+		}
+		if !isRetryableExportError(err) {
+			exportBufferInstruments.dropped.Add(ctx, 1, b.attrs)
+			return fmt.Errorf("%s batch rejected permanently, dropping it: %w", b.signal, err)
+		}
+	}
+
+	payload, marshalErr := proto.Marshal(msg)
+	if marshalErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to encode %s batch for the export buffer: %w", b.signal, marshalErr))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if appendErr := b.appendLocked(payload); appendErr != nil {
+		return errors.Join(err, appendErr)
+	}
+
+	return fmt.Errorf("%s batch buffered on disk (%d buffered): %w", b.signal, len(b.batches), err)
+}
+
+func (b *exportBuffer) replayBatches(ctx context.Context) error {
+	/*
+		send the buffered batches in order, until one fails in a way that may succeed later. a batch the
+		endpoint rejects permanently is dropped, so that it does not hold up the batches behind it. only
+		one caller replays at a time, and errReplayInProgress is returned to any other. batches appended
+		during the replay are replayed by it as well
+	*/
+
+	b.mu.Lock()
+	if b.replaying {
+		b.mu.Unlock()
+		return errReplayInProgress
+	}
+	b.replaying = true
+	b.mu.Unlock()
+
+	for {
+		b.mu.Lock()
+		if len(b.batches) == 0 {
+			b.replaying = false
+			b.mu.Unlock()
+			return nil
+		}
+		batch := b.batches[0]
+		b.mu.Unlock()
+
+		payload, err := os.ReadFile(batch.path)
+		if err == nil {
+			err = b.replay(ctx, payload)
+			switch {
+			case err == nil:
+				exportBufferInstruments.replayed.Add(ctx, 1, b.attrs)
+			case isRetryableExportError(err):
+				b.mu.Lock()
+				b.replaying = false
+				b.mu.Unlock()
+				return err
+			default:
+				log.Printf("telemetry: dropping %s batch %s rejected permanently: %v\n", b.signal, batch.path, err)
+				exportBufferInstruments.dropped.Add(ctx, 1, b.attrs)
+			}
+		} else {
+			log.Printf("telemetry: dropping unreadable %s batch %s: %v\n", b.signal, batch.path, err)
+			exportBufferInstruments.dropped.Add(ctx, 1, b.attrs)
+		}
+
+		b.mu.Lock()
+		// the batch may have been dropped to make room while it was sent
+		if len(b.batches) > 0 && b.batches[0].path == batch.path {
+			b.removeOldestLocked()
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *exportBuffer) removeOldestLocked() {
+	batch := b.batches[0]
+	if err := os.Remove(batch.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("telemetry: failed to remove buffered %s batch %s: %v\n", b.signal, batch.path, err)
+	}
+	b.batches = b.batches[1:]
+	b.size.Add(-batch.size)
+}
+
+func (b *exportBuffer) appendLocked(payload []byte) error {
+	/*
+		write a batch behind the ones already buffered, dropping the oldest batches until it fits. the
+		batch is written to a temporary file first, so that a partially written batch is never replayed
+	*/
+
+	size := int64(len(payload))
+	if size > b.settings.maxBytes {
+		exportBufferInstruments.dropped.Add(context.Background(), 1, b.attrs)
+		return fmt.Errorf("%s batch of %d bytes exceeds the export buffer size of %d bytes, dropping it",
+			b.signal, size, b.settings.maxBytes)
+	}
+	for len(b.batches) > 0 && b.size.Load()+size > b.settings.maxBytes {
+		b.removeOldestLocked()
+		exportBufferInstruments.dropped.Add(context.Background(), 1, b.attrs)
+	}
+
+	path := filepath.Join(b.settings.dir, fmt.Sprintf("%020d%s", b.sequence, exportBufferFileSuffix))
+	if err := os.WriteFile(path+".tmp", payload, 0o644); err != nil {
+		return fmt.Errorf("failed to buffer %s batch: %w", b.signal, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to buffer %s batch: %w", b.signal, err)
+	}
+
+	b.sequence++
+	b.batches = append(b.batches, bufferedBatch{path: path, size: size})
+	b.size.Add(size)
+	return nil
+}
+
+// retryableExportCodes are the grpc codes for which the OTLP specification allows an export to be sent again
+var retryableExportCodes = []codes.Code{
+	codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.OutOfRange,
+	codes.Unavailable, codes.DataLoss,
+}
+
+// otlpHTTPStatusPattern extracts the response status from the errors of the OTLP/HTTP trace and log clients,
+// which do not expose it otherwise, e.g. `failed to send to http://collector:4318/v1/traces: 400 Bad Request`
+var otlpHTTPStatusPattern = regexp.MustCompile(`failed to send to \S+: (\d{3})\b`)
+
+func isRetryableExportError(err error) bool {
+	/*
+		tell whether an export that failed with `err` may succeed when it is sent again: failures to
+		reach the endpoint, 429 and 5xx responses, and the grpc codes of temporary conditions. a batch
+		the endpoint rejected for what it contains, e.g. with InvalidArgument or a 400, or for being too
+		large, fails the same way every time it is sent
+	*/
+
+	var httpErr *otlpHTTPError
+	if errors.As(err, &httpErr) {
+		return retryableHTTPStatus(httpErr.status)
+	}
+	if match := otlpHTTPStatusPattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return retryableHTTPStatus(code)
+	}
+
+	if s, ok := status.FromError(err); ok {
+		// grpc reports messages above the size limit of either side as ResourceExhausted
+		if s.Code() == codes.ResourceExhausted && strings.Contains(s.Message(), "larger than max") {
+			return false
+		}
+		return slices.Contains(retryableExportCodes, s.Code())
+	}
+
+	return true
+}
+
+func retryableHTTPStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// bufferedTraceClient wraps an OTLP trace client, buffering batches it fails to upload
+type bufferedTraceClient struct {
+	otlptrace.Client
+	buffer *exportBuffer
+}
+
+func newBufferedTraceClient(client otlptrace.Client) *bufferedTraceClient {
+	c := &bufferedTraceClient{Client: client}
+	c.buffer = newExportBuffer("traces", resolveExportBufferSettings("traces"), func(ctx context.Context, payload []byte) error {
+		request := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			return err
+		}
+		return client.UploadTraces(ctx, request.ResourceSpans)
+	})
+	return c
+}
+
+func (c *bufferedTraceClient) Start(ctx context.Context) error {
+	if err := c.Client.Start(ctx); err != nil {
+		return err
+	}
+	return c.buffer.Start()
+}
+
+func (c *bufferedTraceClient) Stop(ctx context.Context) error {
+	c.buffer.Stop()
+	return c.Client.Stop(ctx)
+}
+
+func (c *bufferedTraceClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	return c.buffer.Upload(ctx, &coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans}, func(ctx context.Context) error {
+		return c.Client.UploadTraces(ctx, protoSpans)
+	})
+}
+
+// bufferedLogClient wraps an OTLP log client, buffering batches it fails to upload
+type bufferedLogClient struct {
+	otlplogs.Client
+	buffer *exportBuffer
+}
+
+func newBufferedLogClient(client otlplogs.Client) *bufferedLogClient {
+	c := &bufferedLogClient{Client: client}
+	c.buffer = newExportBuffer("logs", resolveExportBufferSettings("logs"), func(ctx context.Context, payload []byte) error {
+		request := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			return err
+		}
+		return client.UploadLogs(ctx, request.ResourceLogs)
+	})
+	return c
+}
+
+func (c *bufferedLogClient) Start(ctx context.Context) error {
+	if err := c.Client.Start(ctx); err != nil {
+		return err
+	}
+	return c.buffer.Start()
+}
+
+func (c *bufferedLogClient) Stop(ctx context.Context) error {
+	c.buffer.Stop()
+	return c.Client.Stop(ctx)
+}
+
+func (c *bufferedLogClient) UploadLogs(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+	return c.buffer.Upload(ctx, &collogspb.ExportLogsServiceRequest{ResourceLogs: protoLogs}, func(ctx context.Context) error {
+		return c.Client.UploadLogs(ctx, protoLogs)
+	})
+}
+
+// bufferedMetricClient wraps an OTLP metric client, buffering batches it fails to upload
+type bufferedMetricClient struct {
+	metricClient
+	buffer *exportBuffer
+}
+
+func newBufferedMetricClient(client metricClient) *bufferedMetricClient {
+	c := &bufferedMetricClient{metricClient: client}
+	c.buffer = newExportBuffer("metrics", resolveExportBufferSettings("metrics"), func(ctx context.Context, payload []byte) error {
+		request := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			return err
+		}
+		for _, rm := range request.ResourceMetrics {
+			if err := client.UploadMetrics(ctx, rm); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return c
+}
+
+func (c *bufferedMetricClient) Start(ctx context.Context) error {
+	if err := c.metricClient.Start(ctx); err != nil {
+		return err
+	}
+	return c.buffer.Start()
+}
+
+func (c *bufferedMetricClient) Stop(ctx context.Context) error {
+	c.buffer.Stop()
+	return c.metricClient.Stop(ctx)
+}
+
+func (c *bufferedMetricClient) UploadMetrics(ctx context.Context, protoMetrics *metricpb.ResourceMetrics) error {
+	request := &colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricpb.ResourceMetrics{protoMetrics}}
+	return c.buffer.Upload(ctx, request, func(ctx context.Context) error {
+		return c.metricClient.UploadMetrics(ctx, protoMetrics)
+	})
+}
@@ -0,0 +1,261 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// errUnavailable is a retryable export error, as returned when the collector cannot be reached
+var errUnavailable = status.Error(codes.Unavailable, "connection refused")
+
+// replayRecorder records the payloads a buffer replays, failing with err while it is set
+type replayRecorder struct {
+	mu       sync.Mutex
+	err      error
+	replayed []string
+}
+
+func (r *replayRecorder) replay(_ context.Context, payload []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	value := &wrapperspb.StringValue{}
+	if err := proto.Unmarshal(payload, value); err != nil {
+		return err
+	}
+	r.replayed = append(r.replayed, value.Value)
+	return nil
+}
+
+func (r *replayRecorder) batches() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.replayed)
+}
+
+func newTestExportBuffer(t *testing.T, dir string, maxBytes int64, replay *replayRecorder) *exportBuffer {
+	/*
+		open a buffer on `dir` without starting its background replay
+	*/
+
+	if err := initExportBufferInstruments(); err != nil {
+		t.Fatalf("failed to create export buffer metrics: %v", err)
+	}
+	b := newExportBuffer("traces", &exportBufferSettings{dir: dir, maxBytes: maxBytes}, replay.replay)
+	if err := b.load(); err != nil {
+		t.Fatalf("failed to load export buffer: %v", err)
+	}
+	return b
+}
+
+func upload(b *exportBuffer, value string, sendErr error) error {
+	return b.Upload(context.Background(), wrapperspb.String(value), func(context.Context) error { return sendErr })
+}
+
+func bufferedFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read export buffer: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestExportBufferReplayAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	replay := &replayRecorder{err: errUnavailable}
+
+	first := newTestExportBuffer(t, dir, 1<<20, replay)
+	for i := range 12 {
+		if err := upload(first, fmt.Sprint(i), errUnavailable); err == nil || !strings.Contains(err.Error(), "buffered") {
+			t.Fatalf("Upload returned %v, want the batch to be buffered", err)
+		}
+	}
+
+	// the next process continues the sequence, and replays batches 0 to 11 in order before sending its own
+	replay.err = nil
+	second := newTestExportBuffer(t, dir, 1<<20, replay)
+	if second.sequence != 12 {
+		t.Errorf("sequence = %d after loading 12 batches, want 12", second.sequence)
+	}
+	var sent bool
+	err := second.Upload(context.Background(), wrapperspb.String("new"), func(context.Context) error {
+		sent = true
+		return nil
+	})
+	if err != nil || !sent {
+		t.Fatalf("Upload returned %v, sent %t, want the batch to be sent", err, sent)
+	}
+
+	want := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}
+	if got := replay.batches(); !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if files := bufferedFiles(t, dir); len(files) != 0 {
+		t.Errorf("buffer still holds %v after replaying", files)
+	}
+}
+
+func TestExportBufferEviction(t *testing.T) {
+	dir := t.TempDir()
+	replay := &replayRecorder{err: errUnavailable}
+	payloadSize, _ := proto.Marshal(wrapperspb.String("0"))
+
+	// room for two batches, so that buffering the third drops the first
+	b := newTestExportBuffer(t, dir, int64(2*len(payloadSize)), replay)
+	for i := range 3 {
+		_ = upload(b, fmt.Sprint(i), errUnavailable)
+	}
+	if files := bufferedFiles(t, dir); len(files) != 2 {
+		t.Errorf("buffer holds %v, want 2 batches", files)
+	}
+	if got := b.size.Load(); got != int64(2*len(payloadSize)) {
+		t.Errorf("size = %d, want %d", got, 2*len(payloadSize))
+	}
+
+	replay.err = nil
+	if err := b.replayBatches(context.Background()); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got := replay.batches(); !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("replayed %v, want the two newest batches", got)
+	}
+}
+
+func TestExportBufferOversizedBatch(t *testing.T) {
+	dir := t.TempDir()
+	b := newTestExportBuffer(t, dir, 4, &replayRecorder{})
+
+	err := upload(b, "more than four bytes", errUnavailable)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the export buffer size of 4 bytes") {
+		t.Errorf("Upload returned %v, want the batch to be dropped for its size", err)
+	}
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("Upload returned %v, want it to wrap the export error", err)
+	}
+	if files := bufferedFiles(t, dir); len(files) != 0 {
+		t.Errorf("buffer holds %v, want none", files)
+	}
+}
+
+func TestExportBufferPermanentError(t *testing.T) {
+	dir := t.TempDir()
+	b := newTestExportBuffer(t, dir, 1<<20, &replayRecorder{})
+
+	err := upload(b, "invalid", status.Error(codes.InvalidArgument, "invalid batch"))
+	if err == nil || !strings.Contains(err.Error(), "rejected permanently") {
+		t.Errorf("Upload returned %v, want the batch to be dropped", err)
+	}
+	if files := bufferedFiles(t, dir); len(files) != 0 {
+		t.Errorf("buffer holds %v, want none", files)
+	}
+}
+
+func TestExportBufferRemovesPartialBatches(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"00000000000000000003.otlp.tmp", "00000000000000000004.otlp"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	b := newTestExportBuffer(t, dir, 1<<20, &replayRecorder{})
+	if files := bufferedFiles(t, dir); !slices.Equal(files, []string{"00000000000000000004.otlp"}) {
+		t.Errorf("buffer holds %v after loading, want only the complete batch", files)
+	}
+	if len(b.batches) != 1 || b.sequence != 5 {
+		t.Errorf("loaded %d batches up to sequence %d, want 1 batch and sequence 5", len(b.batches), b.sequence)
+	}
+}
+
+func TestExportBufferUploadDuringReplay(t *testing.T) {
+	// a slow replay in the background does not hold up new exports, which are buffered behind it
+	dir := t.TempDir()
+	replay := &replayRecorder{err: errUnavailable}
+	b := newTestExportBuffer(t, dir, 1<<20, replay)
+	_ = upload(b, "old", errUnavailable)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	b.replay = func(ctx context.Context, payload []byte) error {
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		replay.mu.Lock()
+		replay.err = nil
+		replay.mu.Unlock()
+		return replay.replay(ctx, payload)
+	}
+	done := make(chan error)
+	go func() { done <- b.replayBatches(context.Background()) }()
+	<-started
+
+	uploaded := make(chan error)
+	go func() { uploaded <- upload(b, "new", nil) }()
+	select {
+	case err := <-uploaded:
+		if !errors.Is(err, errReplayInProgress) {
+			t.Errorf("Upload returned %v, want the batch to be buffered behind the replay", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Upload waited for the replay in the background")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if got := replay.batches(); !slices.Equal(got, []string{"old", "new"}) {
+		t.Errorf("replayed %v, want the old batch ahead of the new one", got)
+	}
+}
+
+func TestIsRetryableExportError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"http 400", errors.New("failed to send to http://collector:4318/v1/traces: 400 Bad Request"), false},
+		{"http 413", errors.New("failed to send to http://collector:4318/v1/logs: 413 Request Entity Too Large"), false},
+		{"http 429", errors.New("failed to send to http://collector:4318/v1/traces: 429 Too Many Requests"), true},
+		{"http 503", errors.New("failed to send to http://collector:4318/v1/traces: 503 Service Unavailable"), true},
+		{"metrics http 400", &otlpHTTPError{url: "http://collector:4318/v1/metrics", status: 400}, false},
+		{"metrics http 502", fmt.Errorf("export: %w", &otlpHTTPError{status: 502}), true},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "invalid"), false},
+		{"grpc unauthenticated", status.Error(codes.Unauthenticated, "no token"), false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"grpc resource exhausted", status.Error(codes.ResourceExhausted, "rate limited"), true},
+		{
+			"grpc message too large",
+			status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000000 vs. 4194304)"),
+			false,
+		},
+		{"unreachable", errors.New("dial tcp 127.0.0.1:4317: connect: connection refused"), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableExportError(tc.err); got != tc.want {
+				t.Errorf("isRetryableExportError(%v) = %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultFileExporterDir        = "telemetry"
+	defaultFileExporterMaxSizeMB  = 100
+	defaultFileExporterMaxBackups = 5
+)
+
+// fileSettings describes where the file exporter for a single signal writes, and when the file is rotated
+type fileSettings struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+}
+
+func envInt(name string, defaultValue int) int {
+	/*
+		parse the environment variable `name` as a non-negative integer, falling back to defaultValue if
+		it is unset or invalid
+	*/
+
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		log.Printf("telemetry: invalid %s value %q, using %d\n", name, value, defaultValue)
+		return defaultValue
+	}
+
+	return i
+}
+
+func envBool(name string, defaultValue bool) *bool {
+	/*
+		parse the environment variable `name` as a boolean, falling back to defaultValue if it is unset
+		or invalid
+	*/
+
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return &defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("telemetry: invalid %s value %q, using %t\n", name, value, defaultValue)
+		return &defaultValue
+	}
+
+	return &b
+}
+
+func resolveFileSettings(signal string) *fileSettings {
+	/*
+		resolve the file exporter settings for `signal`. each signal is written to its own file, since
+		a file read by the collector's otlpjsonfile receiver may only contain a single signal type. the
+		path defaults to `<signal>.jsonl` inside FILE_EXPORTER_DIR, and may be overridden per signal
+		with e.g. FILE_EXPORTER_TRACES_PATH
+	*/
+
+	path := strings.TrimSpace(os.Getenv(fmt.Sprintf("FILE_EXPORTER_%s_PATH", strings.ToUpper(signal))))
+	if path == "" {
+		dir := strings.TrimSpace(os.Getenv("FILE_EXPORTER_DIR"))
+		if dir == "" {
+			dir = defaultFileExporterDir
+		}
+		path = filepath.Join(dir, signal+".jsonl")
+	}
+
+	return &fileSettings{
+		path:       path,
+		maxBytes:   int64(envInt("FILE_EXPORTER_MAX_SIZE_MB", defaultFileExporterMaxSizeMB)) << 20,
+		maxBackups: envInt("FILE_EXPORTER_MAX_BACKUPS", defaultFileExporterMaxBackups),
+	}
+}
+
+// rotatingFile appends lines to a file, renaming it to `<path>.1` (and older backups to `<path>.2` and so on)
+// once writing another line would grow it beyond maxBytes. a maxBytes of 0 disables rotation
+type rotatingFile struct {
+	mu       sync.Mutex
+	settings *fileSettings
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(settings *fileSettings) (*rotatingFile, error) {
+	f := &rotatingFile{settings: settings}
+	if err := os.MkdirAll(filepath.Dir(settings.path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", settings.path, err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.settings.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.settings.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat %s: %w", f.settings.path, err)
+	}
+
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	/*
+		close the current file, shift existing backups up by one, dropping the oldest, and start a new
+		file at the configured path
+	*/
+
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", f.settings.path, err)
+	}
+
+	path := f.settings.path
+	if f.settings.maxBackups == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", path, f.settings.maxBackups))
+	for i := f.settings.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func (f *rotatingFile) WriteLine(line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return fmt.Errorf("file exporter for %s is closed", f.settings.path)
+	}
+
+	n := int64(len(line)) + 1
+	if f.settings.maxBytes > 0 && f.size > 0 && f.size+n > f.settings.maxBytes {
+		if err := f.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", f.settings.path, err)
+		}
+	}
+
+	written, err := f.file.Write(append(line, '\n'))
+	f.size += int64(written)
+	return err
+}
+
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// otlpJSONIDKeys are the fields that OTLP/JSON encodes as hex strings, where protojson would use base64
+var otlpJSONIDKeys = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+func hexEncodeIDs(v any) {
+	switch node := v.(type) {
+	case map[string]any:
+		for key, value := range node {
+			if s, ok := value.(string); ok && otlpJSONIDKeys[key] {
+				if raw, err := base64.StdEncoding.DecodeString(s); err == nil {
+					node[key] = hex.EncodeToString(raw)
+				}
+				continue
+			}
+			hexEncodeIDs(value)
+		}
+	case []any:
+		for _, value := range node {
+			hexEncodeIDs(value)
+		}
+	}
+}
+
+func marshalOTLPJSON(msg proto.Message) ([]byte, error) {
+	/*
+		encode an OTLP export request as a single line of OTLP/JSON. this differs from plain protojson
+		in that enums are encoded as integers and trace and span IDs as hex strings
+	*/
+
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	hexEncodeIDs(v)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// fileClient writes OTLP export requests to a rotating file, one request per line
+type fileClient struct {
+	settings *fileSettings
+	file     *rotatingFile
+}
+
+func (c *fileClient) Start(ctx context.Context) error {
+	file, err := openRotatingFile(c.settings)
+	if err != nil {
+		return err
+	}
+	c.file = file
+	return nil
+}
+
+func (c *fileClient) Stop(ctx context.Context) error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+func (c *fileClient) write(msg proto.Message) error {
+	line, err := marshalOTLPJSON(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode OTLP/JSON for %s: %w", c.settings.path, err)
+	}
+	return c.file.WriteLine(line)
+}
+
+// fileTraceClient satisfies otlptrace.Client, so the OTLP trace exporter takes care of the span conversion
+type fileTraceClient struct {
+	fileClient
+}
+
+func (c *fileTraceClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	return c.write(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+}
+
+// fileLogClient satisfies otlplogs.Client, so the OTLP log exporter takes care of the log record conversion
+type fileLogClient struct {
+	fileClient
+}
+
+func (c *fileLogClient) UploadLogs(ctx context.Context, protoLogs []*logspb.ResourceLogs) error {
+	return c.write(&collogspb.ExportLogsServiceRequest{ResourceLogs: protoLogs})
+}
+
+// fileMetricClient satisfies metricClient, so protoMetricExporter takes care of the metric conversion
+type fileMetricClient struct {
+	fileClient
+}
+
+func (c *fileMetricClient) UploadMetrics(ctx context.Context, protoMetrics *metricpb.ResourceMetrics) error {
+	return c.write(&colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricpb.ResourceMetrics{protoMetrics}})
+}
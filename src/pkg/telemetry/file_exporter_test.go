@@ -0,0 +1,121 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fileLine returns line `i` of the tests below, which is 39 bytes long so that it takes up 40 with its newline
+func fileLine(i int) string {
+	return fmt.Sprintf("line %02d %s", i, strings.Repeat("x", 31))
+}
+
+func readLines(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestRotatingFile(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxBackups int
+		// want maps each file name to the lines it holds, every file holding at most 2 lines of 40 bytes
+		want map[string][]int
+	}{
+		{
+			name:       "backups",
+			maxBackups: 2,
+			want: map[string][]int{
+				"traces.jsonl":   {8, 9},
+				"traces.jsonl.1": {6, 7},
+				"traces.jsonl.2": {4, 5},
+			},
+		},
+		{
+			name:       "no backups",
+			maxBackups: 0,
+			want:       map[string][]int{"traces.jsonl": {8, 9}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			settings := &fileSettings{path: filepath.Join(dir, "traces.jsonl"), maxBytes: 100, maxBackups: tc.maxBackups}
+			f, err := openRotatingFile(settings)
+			if err != nil {
+				t.Fatalf("failed to open file: %v", err)
+			}
+			for i := range 10 {
+				if err := f.WriteLine([]byte(fileLine(i))); err != nil {
+					t.Fatalf("failed to write line %d: %v", i, err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("failed to close file: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", dir, err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			var wantNames []string
+			for name := range tc.want {
+				wantNames = append(wantNames, name)
+			}
+			slices.Sort(wantNames)
+			if !slices.Equal(names, wantNames) {
+				t.Fatalf("directory holds %v, want %v", names, wantNames)
+			}
+
+			for name, lines := range tc.want {
+				var want []string
+				for _, i := range lines {
+					want = append(want, fileLine(i))
+				}
+				if got := readLines(t, filepath.Join(dir, name)); !slices.Equal(got, want) {
+					t.Errorf("%s holds %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	// the size of a file left by a previous run counts towards the limit
+	dir := t.TempDir()
+	settings := &fileSettings{path: filepath.Join(dir, "logs.jsonl"), maxBytes: 100, maxBackups: 1}
+	if err := os.WriteFile(settings.path, []byte(fileLine(0)+"\n"+fileLine(1)+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", settings.path, err)
+	}
+
+	f, err := openRotatingFile(settings)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	if err := f.WriteLine([]byte(fileLine(2))); err != nil {
+		t.Fatalf("failed to write line: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close file: %v", err)
+	}
+
+	if got, want := readLines(t, settings.path+".1"), []string{fileLine(0), fileLine(1)}; !slices.Equal(got, want) {
+		t.Errorf("%s.1 holds %q, want %q", settings.path, got, want)
+	}
+	if got, want := readLines(t, settings.path), []string{fileLine(2)}; !slices.Equal(got, want) {
+		t.Errorf("%s holds %q, want %q", settings.path, got, want)
+	}
+	if err := f.WriteLine([]byte(fileLine(3))); err == nil {
+		t.Errorf("WriteLine succeeded after Close, want an error")
+	}
+}
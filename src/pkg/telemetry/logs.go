@@ -0,0 +1,219 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs/otlplogsgrpc"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs/otlplogshttp"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/stdout/stdoutlogs"
+	sdklogs "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type noopLogExporter struct{}
+
+func (e *noopLogExporter) Shutdown(ctx context.Context) error { return nil }
+
+func (e *noopLogExporter) Export(ctx context.Context, batch []sdklogs.ReadableLogRecord) error {
+	return nil
+}
+
+func newLogExporter(ctx context.Context, cfg *config, exporterType string) (sdklogs.LogRecordExporter, error) {
+	/*
+		resolve which log exporter to use from the value of exporterType
+	*/
+
+	switch exporterType {
+	case exporterStdout:
+		// export logs to stdout of this service
+		return stdoutlogs.NewExporter()
+	case exporterOTLP, exporterOTLPHTTP:
+		settings, err := resolveOTLPSettings("logs", exporterType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure LoggerProvider: %w", err)
+		}
+		// export logs to an otel collector
+		if cfg.exportBufferEnabled("logs") {
+			// failed batches are retried by replaying them from the buffer
+			settings.withoutRetry = true
+			return otlplogs.NewExporter(ctx, otlplogs.WithClient(newBufferedLogClient(newOTLPLogClient(settings))))
+		}
+		return otlplogs.NewExporter(ctx, otlplogs.WithClient(newOTLPLogClient(settings)))
+	case exporterFile:
+		// export logs as OTLP/JSON lines to a local file
+		return otlplogs.NewExporter(ctx, otlplogs.WithClient(&fileLogClient{fileClient{settings: resolveFileSettings("logs")}}))
+	default:
+		// do not export logs
+		return &noopLogExporter{}, nil
+	}
+}
+
+func newOTLPLogClient(settings *otlpSettings) otlplogs.Client {
+	/*
+		construct a grpc or http/protobuf OTLP client for logs from the resolved settings
+	*/
+
+	if settings.protocol == protocolHTTPProtobuf {
+		opts := []otlplogshttp.Option{
+			otlplogshttp.WithProtobufProtocol(),
+			otlplogshttp.WithEndpoint(settings.endpoint),
+			otlplogshttp.WithURLPath(settings.urlPath),
+			otlplogshttp.WithHeaders(settings.headers),
+		}
+		if settings.insecure {
+			opts = append(opts, otlplogshttp.WithInsecure())
+		} else {
+			opts = append(opts, otlplogshttp.WithTLSClientConfig(settings.tlsConfig))
+		}
+		if settings.compression == compressionGzip {
+			opts = append(opts, otlplogshttp.WithCompression(otlplogshttp.GzipCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlplogshttp.WithTimeout(settings.timeout))
+		}
+		if settings.withoutRetry {
+			opts = append(opts, otlplogshttp.WithRetry(otlplogshttp.RetryConfig{Enabled: false}))
+		}
+		return otlplogshttp.NewClient(opts...)
+	}
+
+	opts := []otlplogsgrpc.Option{
+		otlplogsgrpc.WithEndpoint(settings.endpoint),
+		otlplogsgrpc.WithHeaders(settings.headers),
+	}
+	if settings.insecure {
+		opts = append(opts, otlplogsgrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlplogsgrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+	}
+	if settings.compression == compressionGzip {
+		opts = append(opts, otlplogsgrpc.WithCompressor(compressionGzip))
+	}
+	if settings.timeout > 0 {
+		opts = append(opts, otlplogsgrpc.WithTimeout(settings.timeout))
+	}
+	if settings.withoutRetry {
+		opts = append(opts, otlplogsgrpc.WithRetry(otlplogsgrpc.RetryConfig{Enabled: false}))
+	}
+	return otlplogsgrpc.NewClient(opts...)
+}
+
+// namedLogExporter prefixes export errors with the type of the wrapped exporter, so that with several exporters
+// configured it is clear which one failed, and records the duration and outcome of every export
+type namedLogExporter struct {
+	sdklogs.LogRecordExporter
+	name     string
+	observer *exportObserver
+	// enabled is switched through the admin API. log records passed to a disabled exporter are dropped
+	enabled *atomic.Bool
+	// queue is the bound of the batch processor in front of the exporter, nil for a simple processor
+	queue *queueBound
+}
+
+func (e *namedLogExporter) Export(ctx context.Context, batch []sdklogs.ReadableLogRecord) error {
+	e.queue.release(len(batch))
+	if !e.enabled.Load() {
+		return nil
+	}
+	start := time.Now()
+	err := e.LogRecordExporter.Export(ctx, batch)
+	e.observer.record(ctx, start, len(batch), err)
+	if err != nil {
+		return &exportError{signal: "logs", exporter: e.name, err: err}
+	}
+	return nil
+}
+
+func (e *namedLogExporter) Shutdown(ctx context.Context) error {
+	if err := e.LogRecordExporter.Shutdown(ctx); err != nil {
+		return fmt.Errorf("logs exporter %s: %w", e.name, err)
+	}
+	return nil
+}
+
+func batchLogRecordProcessorOptions(ps *processorSettings) []sdklogs.BatchLogRecordProcessorOption {
+	/*
+		the settings of a batch processor in the configuration file apply where the matching OTEL_BLRP_*
+		variable is unset. the processor blocks rather than drops log records when its queue is full,
+		which the queueBound in front of it never lets happen
+	*/
+
+	opts := []sdklogs.BatchLogRecordProcessorOption{sdklogs.WithBlocking()}
+	if ps == nil {
+		return opts
+	}
+	if _, ok := os.LookupEnv("OTEL_BLRP_SCHEDULE_DELAY"); !ok && ps.scheduleDelay > 0 {
+		opts = append(opts, sdklogs.WithBatchTimeout(ps.scheduleDelay))
+	}
+	if _, ok := os.LookupEnv("OTEL_BLRP_EXPORT_TIMEOUT"); !ok && ps.exportTimeout > 0 {
+		opts = append(opts, sdklogs.WithExportTimeout(ps.exportTimeout))
+	}
+	if _, ok := os.LookupEnv("OTEL_BLRP_MAX_QUEUE_SIZE"); !ok && ps.maxQueueSize > 0 {
+		opts = append(opts, sdklogs.WithMaxQueueSize(ps.maxQueueSize))
+	}
+	if _, ok := os.LookupEnv("OTEL_BLRP_MAX_EXPORT_BATCH_SIZE"); !ok && ps.maxExportBatchSize > 0 {
+		opts = append(opts, sdklogs.WithMaxExportBatchSize(ps.maxExportBatchSize))
+	}
+	return opts
+}
+
+func newLoggerProvider(
+	ctx context.Context, cfg *config, res *resource.Resource, mem *Memory, pipeline *pipelineMetrics,
+	controls *runtimeControls, processors *signalProcessors,
+) (*sdklogs.LoggerProvider, error) {
+	/*
+		construct a logger provider that exports logs to every backend in cfg.logsExporters, each through
+		its own batch processor. logs recorded in memory are exported as soon as they are written
+	*/
+
+	opts := []sdklogs.LoggerProviderOption{sdklogs.WithResource(res)}
+	for _, processor := range processors.logs {
+		opts = append(opts, sdklogs.WithLogRecordProcessor(processor))
+	}
+
+	var exporters []sdklogs.LogRecordExporter
+	for _, exporterType := range cfg.logsExporters {
+		if exporterType == exporterMemory {
+			opts = append(opts, sdklogs.WithSyncer(mem.Logs))
+			continue
+		}
+
+		logExporter, err := newLogExporter(ctx, cfg, exporterType)
+		if err != nil {
+			for _, exporter := range exporters {
+				err = errors.Join(err, exporter.Shutdown(ctx))
+			}
+			return nil, err
+		}
+		exporters = append(exporters, logExporter)
+
+		named := &namedLogExporter{
+			LogRecordExporter: logExporter,
+			name:              exporterType,
+			observer:          pipeline.newExportObserver("logs", exporterType),
+			enabled:           controls.exporterEnabled("logs"),
+		}
+		ps := cfg.processorSettings("logs", exporterType)
+		if ps != nil && ps.simple {
+			opts = append(opts, sdklogs.WithLogRecordProcessor(sdklogs.NewSimpleLogRecordProcessor(named)))
+			continue
+		}
+
+		named.queue = pipeline.newQueueBound("logs",
+			maxQueueSize("OTEL_BLRP_MAX_QUEUE_SIZE", ps, sdklogs.DefaultMaxQueueSize))
+		processor := sdklogs.NewBatchLogRecordProcessor(named, batchLogRecordProcessorOptions(ps)...)
+		bounded := &boundedLogRecordProcessor{LogRecordProcessor: processor, bound: named.queue}
+		opts = append(opts, sdklogs.WithLogRecordProcessor(bounded))
+	}
+
+	return sdklogs.NewLoggerProvider(opts...), nil
+}
@@ -0,0 +1,93 @@
+package telemetry
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	sdklogs "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+	"github.com/agoda-com/opentelemetry-logs-go/sdk/logs/logstest"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Memory holds the telemetry recorded by signals configured with the `memory` exporter. the field for a signal
+// that uses another exporter is nil. spans and logs are recorded synchronously, as soon as a span ends or a log
+// is written, while metrics are only aggregated when collected through the Metrics reader
+type Memory struct {
+	Spans   *tracetest.InMemoryExporter
+	Metrics *sdkmetric.ManualReader
+	Logs    *InMemoryLogExporter
+}
+
+func newMemory(cfg *config) *Memory {
+	/*
+		construct in-memory exporters for every signal that is configured with the `memory` exporter,
+		or return nil if there are none
+	*/
+
+	m := &Memory{}
+	if slices.Contains(cfg.tracesExporters, exporterMemory) {
+		m.Spans = tracetest.NewInMemoryExporter()
+	}
+	if slices.Contains(cfg.metricsExporters, exporterMemory) {
+		var opts []sdkmetric.ManualReaderOption
+		if producer := newRuntimeProducer(cfg); producer != nil {
+			opts = append(opts, sdkmetric.WithProducer(producer))
+		}
+		m.Metrics = sdkmetric.NewManualReader(opts...)
+	}
+	if slices.Contains(cfg.logsExporters, exporterMemory) {
+		m.Logs = NewInMemoryLogExporter()
+	}
+
+	if m.Spans == nil && m.Metrics == nil && m.Logs == nil {
+		return nil
+	}
+	return m
+}
+
+// InMemoryLogExporter stores exported log records in memory, in the order they were exported
+type InMemoryLogExporter struct {
+	mu   sync.Mutex
+	logs logstest.LogRecordStubs
+}
+
+func NewInMemoryLogExporter() *InMemoryLogExporter {
+	return &InMemoryLogExporter{}
+}
+
+func (e *InMemoryLogExporter) Export(ctx context.Context, batch []sdklogs.ReadableLogRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, record := range batch {
+		e.logs = append(e.logs, logstest.LogRecordStubFromReadableLogRecord(record))
+	}
+	return nil
+}
+
+func (e *InMemoryLogExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (e *InMemoryLogExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.logs = nil
+}
+
+func (e *InMemoryLogExporter) GetLogs() logstest.LogRecordStubs {
+	/*
+		return a copy of the log records exported so far
+	*/
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	logs := make(logstest.LogRecordStubs, len(e.logs))
+	copy(logs, e.logs)
+	return logs
+}
@@ -0,0 +1,205 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultOTLPTimeout bounds a single export when OTEL_EXPORTER_OTLP_TIMEOUT is not set
+const defaultOTLPTimeout = 10 * time.Second
+
+// metricClient uploads metrics that have already been converted to OTLP, the counterpart of otlptrace.Client
+// for metrics. the OTLP metric exporters of the SDK do not expose their clients, so this is what allows
+// metrics to be written to a file or buffered on disk
+type metricClient interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	UploadMetrics(ctx context.Context, protoMetrics *metricpb.ResourceMetrics) error
+}
+
+// protoMetricExporter satisfies sdkmetric.Exporter by converting collected metrics to OTLP and handing them to
+// a metricClient
+type protoMetricExporter struct {
+	client metricClient
+	// temporality and aggregation fall back to the SDK defaults when nil
+	temporality sdkmetric.TemporalitySelector
+	aggregation sdkmetric.AggregationSelector
+}
+
+func newProtoMetricExporter(ctx context.Context, client metricClient) (*protoMetricExporter, error) {
+	if err := client.Start(ctx); err != nil {
+		return nil, err
+	}
+	return &protoMetricExporter{client: client}, nil
+}
+
+func (e *protoMetricExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	if e.temporality != nil {
+		return e.temporality(kind)
+	}
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *protoMetricExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	if e.aggregation != nil {
+		return e.aggregation(kind)
+	}
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *protoMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.client.UploadMetrics(ctx, resourceMetricsToProto(rm))
+}
+
+func (e *protoMetricExporter) ForceFlush(ctx context.Context) error { return nil }
+
+func (e *protoMetricExporter) Shutdown(ctx context.Context) error {
+	return e.client.Stop(ctx)
+}
+
+// otlpMetricClient sends metrics to the collector over grpc or http/protobuf, honoring the same settings as
+// the OTLP metric exporters of the SDK
+type otlpMetricClient struct {
+	settings *otlpSettings
+	conn     *grpc.ClientConn
+	grpc     colmetricpb.MetricsServiceClient
+	http     *http.Client
+}
+
+func newOTLPMetricClient(settings *otlpSettings) *otlpMetricClient {
+	return &otlpMetricClient{settings: settings}
+}
+
+func (c *otlpMetricClient) Start(ctx context.Context) error {
+	if c.settings.protocol == protocolHTTPProtobuf {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.settings.tlsConfig
+		c.http = &http.Client{Transport: transport}
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if !c.settings.insecure {
+		creds = credentials.NewTLS(c.settings.tlsConfig)
+	}
+	conn, err := grpc.NewClient(c.settings.endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to create grpc connection to %s: %w", c.settings.endpoint, err)
+	}
+	c.conn, c.grpc = conn, colmetricpb.NewMetricsServiceClient(conn)
+
+	return nil
+}
+
+func (c *otlpMetricClient) Stop(ctx context.Context) error {
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *otlpMetricClient) UploadMetrics(ctx context.Context, protoMetrics *metricpb.ResourceMetrics) error {
+	timeout := c.settings.timeout
+	if timeout == 0 {
+		timeout = defaultOTLPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request := &colmetricpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricpb.ResourceMetrics{protoMetrics}}
+	if c.settings.protocol == protocolHTTPProtobuf {
+		return c.uploadHTTP(ctx, request)
+	}
+
+	if len(c.settings.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(c.settings.headers))
+	}
+	var opts []grpc.CallOption
+	if c.settings.compression == compressionGzip {
+		opts = append(opts, grpc.UseCompressor(compressionGzip))
+	}
+	if _, err := c.grpc.Export(ctx, request, opts...); err != nil {
+		return fmt.Errorf("metrics export: %w", err)
+	}
+
+	return nil
+}
+
+func (c *otlpMetricClient) uploadHTTP(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	if c.settings.compression == compressionGzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	scheme := "https"
+	if c.settings.insecure {
+		scheme = "http"
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, c.settings.endpoint, c.settings.urlPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if c.settings.compression == compressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range c.settings.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("metrics export: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &otlpHTTPError{url: url, status: resp.StatusCode, statusText: resp.Status}
+	}
+	return nil
+}
+
+// otlpHTTPError is returned when the collector responds to an OTLP/HTTP export with a non-2xx status
+type otlpHTTPError struct {
+	url        string
+	status     int
+	statusText string
+}
+
+func (e *otlpHTTPError) Error() string {
+	return fmt.Sprintf("metrics export: %s responded with %s", e.url, e.statusText)
+}
@@ -0,0 +1,301 @@
+package telemetry
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// the OTLP metric exporters keep their conversion from metricdata to protobuf internal, so exporters in this
+// package that need OTLP protobuf messages for metrics, rather than for spans or logs, convert them here
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func attributeValueToProto(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.STRING:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.AsString()}}
+	}
+
+	var values []*commonpb.AnyValue
+	switch v.Type() {
+	case attribute.BOOLSLICE:
+		for _, b := range v.AsBoolSlice() {
+			values = append(values, attributeValueToProto(attribute.BoolValue(b)))
+		}
+	case attribute.INT64SLICE:
+		for _, i := range v.AsInt64Slice() {
+			values = append(values, attributeValueToProto(attribute.Int64Value(i)))
+		}
+	case attribute.FLOAT64SLICE:
+		for _, f := range v.AsFloat64Slice() {
+			values = append(values, attributeValueToProto(attribute.Float64Value(f)))
+		}
+	case attribute.STRINGSLICE:
+		for _, s := range v.AsStringSlice() {
+			values = append(values, attributeValueToProto(attribute.StringValue(s)))
+		}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+}
+
+func attributesToProto(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: attributeValueToProto(kv.Value)})
+	}
+
+	return out
+}
+
+func resourceToProto(res *resource.Resource) *resourcepb.Resource {
+	if res == nil {
+		return &resourcepb.Resource{}
+	}
+	return &resourcepb.Resource{Attributes: attributesToProto(res.Attributes())}
+}
+
+func scopeToProto(scope instrumentation.Scope) *commonpb.InstrumentationScope {
+	return &commonpb.InstrumentationScope{Name: scope.Name, Version: scope.Version}
+}
+
+func temporalityToProto(t metricdata.Temporality) metricpb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	default:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+	}
+}
+
+func exemplarsToProto[N int64 | float64](exemplars []metricdata.Exemplar[N]) []*metricpb.Exemplar {
+	if len(exemplars) == 0 {
+		return nil
+	}
+
+	out := make([]*metricpb.Exemplar, 0, len(exemplars))
+	for _, e := range exemplars {
+		pe := &metricpb.Exemplar{
+			FilteredAttributes: attributesToProto(e.FilteredAttributes),
+			TimeUnixNano:       unixNano(e.Time),
+			SpanId:             e.SpanID,
+			TraceId:            e.TraceID,
+		}
+		switch v := any(e.Value).(type) {
+		case int64:
+			pe.Value = &metricpb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			pe.Value = &metricpb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, pe)
+	}
+
+	return out
+}
+
+func numberDataPointsToProto[N int64 | float64](points []metricdata.DataPoint[N]) []*metricpb.NumberDataPoint {
+	out := make([]*metricpb.NumberDataPoint, 0, len(points))
+	for _, p := range points {
+		pp := &metricpb.NumberDataPoint{
+			Attributes:        attributesToProto(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Exemplars:         exemplarsToProto(p.Exemplars),
+		}
+		switch v := any(p.Value).(type) {
+		case int64:
+			pp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			pp.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, pp)
+	}
+
+	return out
+}
+
+func extremaToProto[N int64 | float64](e metricdata.Extrema[N]) *float64 {
+	v, ok := e.Value()
+	if !ok {
+		return nil
+	}
+	f := float64(v)
+	return &f
+}
+
+func histogramDataPointsToProto[N int64 | float64](points []metricdata.HistogramDataPoint[N]) []*metricpb.HistogramDataPoint {
+	out := make([]*metricpb.HistogramDataPoint, 0, len(points))
+	for _, p := range points {
+		sum := float64(p.Sum)
+		out = append(out, &metricpb.HistogramDataPoint{
+			Attributes:        attributesToProto(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               &sum,
+			BucketCounts:      p.BucketCounts,
+			ExplicitBounds:    p.Bounds,
+			Min:               extremaToProto(p.Min),
+			Max:               extremaToProto(p.Max),
+			Exemplars:         exemplarsToProto(p.Exemplars),
+		})
+	}
+
+	return out
+}
+
+func exponentialHistogramDataPointsToProto[N int64 | float64](
+	points []metricdata.ExponentialHistogramDataPoint[N],
+) []*metricpb.ExponentialHistogramDataPoint {
+	out := make([]*metricpb.ExponentialHistogramDataPoint, 0, len(points))
+	for _, p := range points {
+		sum := float64(p.Sum)
+		out = append(out, &metricpb.ExponentialHistogramDataPoint{
+			Attributes:        attributesToProto(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               &sum,
+			Scale:             p.Scale,
+			ZeroCount:         p.ZeroCount,
+			ZeroThreshold:     p.ZeroThreshold,
+			Positive: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       p.PositiveBucket.Offset,
+				BucketCounts: p.PositiveBucket.Counts,
+			},
+			Negative: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       p.NegativeBucket.Offset,
+				BucketCounts: p.NegativeBucket.Counts,
+			},
+			Min:       extremaToProto(p.Min),
+			Max:       extremaToProto(p.Max),
+			Exemplars: exemplarsToProto(p.Exemplars),
+		})
+	}
+
+	return out
+}
+
+func summaryDataPointsToProto(points []metricdata.SummaryDataPoint) []*metricpb.SummaryDataPoint {
+	out := make([]*metricpb.SummaryDataPoint, 0, len(points))
+	for _, p := range points {
+		quantiles := make([]*metricpb.SummaryDataPoint_ValueAtQuantile, 0, len(p.QuantileValues))
+		for _, q := range p.QuantileValues {
+			quantiles = append(quantiles, &metricpb.SummaryDataPoint_ValueAtQuantile{Quantile: q.Quantile, Value: q.Value})
+		}
+		out = append(out, &metricpb.SummaryDataPoint{
+			Attributes:        attributesToProto(p.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(p.StartTime),
+			TimeUnixNano:      unixNano(p.Time),
+			Count:             p.Count,
+			Sum:               p.Sum,
+			QuantileValues:    quantiles,
+		})
+	}
+
+	return out
+}
+
+func metricToProto(m metricdata.Metrics) *metricpb.Metric {
+	/*
+		convert a single metric to protobuf. returns nil for aggregations that have no OTLP equivalent
+	*/
+
+	pm := &metricpb.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		pm.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberDataPointsToProto(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		pm.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberDataPointsToProto(data.DataPoints)}}
+	case metricdata.Sum[int64]:
+		pm.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Sum[float64]:
+		pm.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			DataPoints:             numberDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Histogram[int64]:
+		pm.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			DataPoints:             histogramDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.Histogram[float64]:
+		pm.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			DataPoints:             histogramDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[int64]:
+		pm.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			DataPoints:             exponentialHistogramDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[float64]:
+		pm.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			DataPoints:             exponentialHistogramDataPointsToProto(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.Summary:
+		pm.Data = &metricpb.Metric_Summary{Summary: &metricpb.Summary{
+			DataPoints: summaryDataPointsToProto(data.DataPoints),
+		}}
+	default:
+		return nil
+	}
+
+	return pm
+}
+
+func resourceMetricsToProto(rm *metricdata.ResourceMetrics) *metricpb.ResourceMetrics {
+	/*
+		convert metrics collected by a reader to their OTLP protobuf representation
+	*/
+
+	out := &metricpb.ResourceMetrics{Resource: resourceToProto(rm.Resource)}
+	if rm.Resource != nil {
+		out.SchemaUrl = rm.Resource.SchemaURL()
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		psm := &metricpb.ScopeMetrics{Scope: scopeToProto(sm.Scope), SchemaUrl: sm.Scope.SchemaURL}
+		for _, m := range sm.Metrics {
+			if pm := metricToProto(m); pm != nil {
+				psm.Metrics = append(psm.Metrics, pm)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, psm)
+	}
+
+	return out
+}
@@ -0,0 +1,503 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type noopMetricExporter struct{}
+
+func (e *noopMetricExporter) Temporality(sdkmetric.InstrumentKind) metricdata.Temporality { return 0 }
+
+func (e *noopMetricExporter) Aggregation(sdkmetric.InstrumentKind) sdkmetric.Aggregation { return nil }
+
+func (e *noopMetricExporter) Export(context.Context, *metricdata.ResourceMetrics) error { return nil }
+
+func (e *noopMetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *noopMetricExporter) Shutdown(context.Context) error { return nil }
+
+func newMetricExporter(ctx context.Context, cfg *config, exporterType string) (sdkmetric.Exporter, error) {
+	/*
+		resolve which metric exporter to use from the value of exporterType
+	*/
+
+	switch exporterType {
+	case exporterStdout:
+		// export metrics to stdout of this service
+		return stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+	case exporterOTLP, exporterOTLPHTTP:
+		settings, err := resolveOTLPSettings("metrics", exporterType)
+		if err == nil {
+			err = settings.applyMetricsEnv()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure MeterProvider: %w", err)
+		}
+		// export metrics to an otel collector. buffering needs access to the OTLP encoded batches,
+		// which the exporters of the SDK do not expose, so buffered metrics use a client of our own
+		if cfg.exportBufferEnabled("metrics") {
+			exporter, err := newProtoMetricExporter(ctx, newBufferedMetricClient(newOTLPMetricClient(settings)))
+			if err != nil {
+				return nil, err
+			}
+			exporter.temporality, exporter.aggregation = settings.temporality, settings.aggregation
+			return exporter, nil
+		}
+		return newOTLPMetricExporter(ctx, settings)
+	case exporterFile:
+		// export metrics as OTLP/JSON lines to a local file
+		return newProtoMetricExporter(ctx, &fileMetricClient{fileClient{settings: resolveFileSettings("metrics")}})
+	default:
+		// do not export metrics
+		return &noopMetricExporter{}, nil
+	}
+}
+
+func newOTLPMetricExporter(ctx context.Context, settings *otlpSettings) (sdkmetric.Exporter, error) {
+	/*
+		construct a grpc or http/protobuf OTLP metric exporter from the resolved settings
+	*/
+
+	if settings.protocol == protocolHTTPProtobuf {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(settings.endpoint),
+			otlpmetrichttp.WithURLPath(settings.urlPath),
+			otlpmetrichttp.WithHeaders(settings.headers),
+		}
+		if settings.insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(settings.tlsConfig))
+		}
+		if settings.compression == compressionGzip {
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlpmetrichttp.WithTimeout(settings.timeout))
+		}
+		if settings.temporality != nil {
+			opts = append(opts, otlpmetrichttp.WithTemporalitySelector(settings.temporality))
+		}
+		if settings.aggregation != nil {
+			opts = append(opts, otlpmetrichttp.WithAggregationSelector(settings.aggregation))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(settings.endpoint),
+		otlpmetricgrpc.WithHeaders(settings.headers),
+	}
+	if settings.insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+	}
+	if settings.compression == compressionGzip {
+		opts = append(opts, otlpmetricgrpc.WithCompressor(compressionGzip))
+	}
+	if settings.timeout > 0 {
+		opts = append(opts, otlpmetricgrpc.WithTimeout(settings.timeout))
+	}
+	if settings.temporality != nil {
+		opts = append(opts, otlpmetricgrpc.WithTemporalitySelector(settings.temporality))
+	}
+	if settings.aggregation != nil {
+		opts = append(opts, otlpmetricgrpc.WithAggregationSelector(settings.aggregation))
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+func temporalitySelector(preference string) (sdkmetric.TemporalitySelector, error) {
+	/*
+		resolve an OTLP temporality preference. `delta` reports counters and histograms as deltas,
+		`lowmemory` does the same except for asynchronous counters, and `cumulative` keeps the SDK default
+	*/
+
+	switch strings.ToLower(strings.TrimSpace(preference)) {
+	case "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			}
+			return metricdata.DeltaTemporality
+		}, nil
+	case "lowmemory":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unsupported temporality preference %q, must be one of `cumulative`, `delta` or `lowmemory`", preference,
+		)
+	}
+}
+
+func histogramAggregationSelector(aggregation string) (sdkmetric.AggregationSelector, error) {
+	/*
+		resolve the default aggregation of histogram instruments, either the SDK default of explicit
+		buckets or a base2 exponential histogram
+	*/
+
+	switch strings.ToLower(strings.TrimSpace(aggregation)) {
+	case "explicit_bucket_histogram":
+		return sdkmetric.DefaultAggregationSelector, nil
+	case "base2_exponential_bucket_histogram":
+		return func(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+			if kind == sdkmetric.InstrumentKindHistogram {
+				return sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+			}
+			return sdkmetric.DefaultAggregationSelector(kind)
+		}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unsupported histogram aggregation %q, must be one of `explicit_bucket_histogram` or "+
+				"`base2_exponential_bucket_histogram`", aggregation,
+		)
+	}
+}
+
+func (s *otlpSettings) applyMetricsEnv() error {
+	/*
+		resolve the temporality preference and default histogram aggregation of an OTLP metric exporter
+		from OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE and
+		OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION
+	*/
+
+	var err error
+	if value := getenv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"); value != "" {
+		if s.temporality, err = temporalitySelector(value); err != nil {
+			return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE: %w", err)
+		}
+	}
+	if value := getenv("OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION"); value != "" {
+		if s.aggregation, err = histogramAggregationSelector(value); err != nil {
+			return fmt.Errorf("invalid OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION: %w", err)
+		}
+	}
+	return nil
+}
+
+// namedMetricExporter prefixes export errors with the type of the wrapped exporter, so that with several
+// exporters configured it is clear which one failed, and records the duration and outcome of every export
+type namedMetricExporter struct {
+	sdkmetric.Exporter
+	name     string
+	observer *exportObserver
+	// enabled is switched through the admin API. metrics passed to a disabled exporter are dropped
+	enabled *atomic.Bool
+}
+
+func (e *namedMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if !e.enabled.Load() {
+		return nil
+	}
+	start := time.Now()
+	err := e.Exporter.Export(ctx, rm)
+	e.observer.record(ctx, start, countDataPoints(rm), err)
+	if err != nil {
+		return &exportError{signal: "metrics", exporter: e.name, err: err}
+	}
+	return nil
+}
+
+func (e *namedMetricExporter) Shutdown(ctx context.Context) error {
+	if err := e.Exporter.Shutdown(ctx); err != nil {
+		return fmt.Errorf("metrics exporter %s: %w", e.name, err)
+	}
+	return nil
+}
+
+// exemplar filters, as named by OTEL_METRICS_EXEMPLAR_FILTER
+const (
+	exemplarFilterTraceBased = "trace_based"
+	exemplarFilterAlwaysOn   = "always_on"
+	exemplarFilterAlwaysOff  = "always_off"
+)
+
+func parseExemplarFilter(value string) (string, error) {
+	/*
+		resolve an exemplar filter. `trace_based` records exemplars only for measurements taken within
+		a sampled span, `always_on` for every measurement and `always_off` for none. defaults to
+		`trace_based`
+	*/
+
+	switch filter := strings.ToLower(strings.TrimSpace(value)); filter {
+	case "":
+		return exemplarFilterTraceBased, nil
+	case exemplarFilterTraceBased, exemplarFilterAlwaysOn, exemplarFilterAlwaysOff:
+		return filter, nil
+	default:
+		return "", fmt.Errorf(
+			"unsupported exemplar filter %q, must be one of `trace_based`, `always_on` or `always_off`", value,
+		)
+	}
+}
+
+// exemplarEnv holds the values Init set for the exemplar variables read by the SDK, so that a later Init may change
+// them without mistaking them for variables set by the user
+var exemplarEnv = struct {
+	sync.Mutex
+	values map[string]string
+}{values: map[string]string{}}
+
+// exemplarVars are the variables the SDK reads exemplar settings from
+var exemplarVars = []string{"OTEL_METRICS_EXEMPLAR_FILTER", "OTEL_GO_X_EXEMPLAR"}
+
+func userEnv(name string) (string, bool) {
+	/*
+		return the value of the environment variable `name`, unless it is unset or was set by Init
+	*/
+
+	value, ok := os.LookupEnv(name)
+	if owned, set := exemplarEnv.values[name]; ok && set && owned == value {
+		return "", false
+	}
+	return value, ok
+}
+
+func setOwnedEnv(name string, value string) error {
+	/*
+		set the environment variable `name`, which the user did not set, to `value`. an empty value unsets
+		it, so that the variable only appears in the environment when it differs from the SDK default
+	*/
+
+	if value == "" {
+		delete(exemplarEnv.values, name)
+		return os.Unsetenv(name)
+	}
+	exemplarEnv.values[name] = value
+	return os.Setenv(name, value)
+}
+
+func enableExemplars(filter string, setEnv bool) (string, func() error, error) {
+	/*
+		the SDK only supports exemplars as an experimental feature, which is switched on by
+		OTEL_GO_X_EXEMPLAR, and reads the filter from OTEL_METRICS_EXEMPLAR_FILTER whenever an
+		instrument is created. neither can be passed as an option, so when `setEnv` is true each is set
+		in the environment of the process before the meter provider is constructed, unless the user set
+		it. a variable set by the user is never overwritten and takes precedence over `filter`. return
+		the filter that is in effect, and a function that restores the variables as they were before
+	*/
+
+	exemplarEnv.Lock()
+	defer exemplarEnv.Unlock()
+
+	if !setEnv {
+		return userExemplarFilter(filter), func() error { return nil }, nil
+	}
+
+	// the value of each variable, and the value a previous Init set it to, if any
+	type previous struct {
+		value, owned string
+		ok, set      bool
+	}
+	saved := make(map[string]previous, len(exemplarVars))
+	for _, name := range exemplarVars {
+		value, ok := os.LookupEnv(name)
+		owned, set := exemplarEnv.values[name]
+		saved[name] = previous{value: value, owned: owned, ok: ok, set: set}
+	}
+	restore := func() error {
+		/*
+			restore the variables this call set, unless they were changed since
+		*/
+
+		exemplarEnv.Lock()
+		defer exemplarEnv.Unlock()
+
+		var errs []error
+		for _, name := range exemplarVars {
+			before := saved[name]
+			value, ok := os.LookupEnv(name)
+			owned, set := exemplarEnv.values[name]
+			if ok == before.ok && value == before.value || ok != set || owned != value {
+				continue
+			}
+
+			if before.set {
+				exemplarEnv.values[name] = before.owned
+			} else {
+				delete(exemplarEnv.values, name)
+			}
+			if before.ok {
+				errs = append(errs, os.Setenv(name, before.value))
+			} else {
+				errs = append(errs, os.Unsetenv(name))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	if value, ok := userEnv("OTEL_METRICS_EXEMPLAR_FILTER"); ok {
+		filter = precedingExemplarFilter(value, filter)
+	} else {
+		value := filter
+		if filter == exemplarFilterTraceBased {
+			value = ""
+		}
+		if err := setOwnedEnv("OTEL_METRICS_EXEMPLAR_FILTER", value); err != nil {
+			return "", nil, errors.Join(err, restore())
+		}
+	}
+
+	if value, ok := userEnv("OTEL_GO_X_EXEMPLAR"); ok {
+		if !strings.EqualFold(value, "true") && filter != exemplarFilterAlwaysOff {
+			log.Printf("telemetry: OTEL_GO_X_EXEMPLAR is set to %q, no exemplars are recorded\n", value)
+			filter = exemplarFilterAlwaysOff
+		}
+		return filter, restore, nil
+	}
+	value := ""
+	if filter != exemplarFilterAlwaysOff {
+		value = "true"
+	}
+	if err := setOwnedEnv("OTEL_GO_X_EXEMPLAR", value); err != nil {
+		return "", nil, errors.Join(err, restore())
+	}
+	return filter, restore, nil
+}
+
+func userExemplarFilter(filter string) string {
+	/*
+		resolve the filter in effect when the exemplar variables are left to the user: exemplars are
+		only recorded when OTEL_GO_X_EXEMPLAR is `true`, according to OTEL_METRICS_EXEMPLAR_FILTER
+	*/
+
+	if value, ok := userEnv("OTEL_GO_X_EXEMPLAR"); !ok || !strings.EqualFold(value, "true") {
+		if filter == exemplarFilterAlwaysOn {
+			log.Printf("telemetry: neither OTEL_GO_X_EXEMPLAR nor EXEMPLAR_ENV_ENABLED is set, no exemplars are recorded\n")
+		}
+		return exemplarFilterAlwaysOff
+	}
+	if value, ok := userEnv("OTEL_METRICS_EXEMPLAR_FILTER"); ok {
+		return precedingExemplarFilter(value, filter)
+	}
+	if filter != exemplarFilterTraceBased {
+		log.Printf(
+			"telemetry: exemplar filter %q is not applied unless EXEMPLAR_ENV_ENABLED is set, using %q\n",
+			filter, exemplarFilterTraceBased,
+		)
+	}
+	return exemplarFilterTraceBased
+}
+
+func precedingExemplarFilter(value string, filter string) string {
+	/*
+		resolve the filter set by the user in OTEL_METRICS_EXEMPLAR_FILTER, which takes precedence over `filter`
+	*/
+
+	// the SDK treats any value it does not know as `trace_based`
+	effective, err := parseExemplarFilter(value)
+	if err != nil {
+		effective = exemplarFilterTraceBased
+	}
+	if effective != filter {
+		log.Printf(
+			"telemetry: OTEL_METRICS_EXEMPLAR_FILTER is set to %q, which takes precedence over exemplar filter %q\n",
+			value, filter,
+		)
+	}
+	return effective
+}
+
+func periodicReaderOptions(ps *processorSettings) []sdkmetric.PeriodicReaderOption {
+	/*
+		metrics are exported every 10 seconds unless OTEL_METRIC_EXPORT_INTERVAL, which the SDK reads
+		itself, or a periodic reader of the configuration file says otherwise
+	*/
+
+	var opts []sdkmetric.PeriodicReaderOption
+	if _, ok := os.LookupEnv("OTEL_METRIC_EXPORT_INTERVAL"); !ok {
+		interval := 10 * time.Second
+		if ps != nil && ps.scheduleDelay > 0 {
+			interval = ps.scheduleDelay
+		}
+		opts = append(opts, sdkmetric.WithInterval(interval))
+	}
+	if _, ok := os.LookupEnv("OTEL_METRIC_EXPORT_TIMEOUT"); !ok && ps != nil && ps.exportTimeout > 0 {
+		opts = append(opts, sdkmetric.WithTimeout(ps.exportTimeout))
+	}
+	return opts
+}
+
+func newMeterProvider(
+	ctx context.Context, cfg *config, res *resource.Resource, mem *Memory, admin *adminServer, pipeline *pipelineMetrics,
+	controls *runtimeControls,
+) (*sdkmetric.MeterProvider, error) {
+	/*
+		construct a meter provider that exports metrics to every backend in cfg.metricsExporters, each
+		through its own reader. metrics recorded in memory, or scraped by Prometheus, are read on demand
+		rather than periodically. exemplars are recorded according to cfg.exemplarFilter, as resolved by
+		enableExemplars, and carried by every reader
+	*/
+
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	if cfg.configFile != nil {
+		opts = append(opts, sdkmetric.WithView(cfg.configFile.views...))
+	}
+
+	var readers []sdkmetric.Reader
+	for _, exporterType := range cfg.metricsExporters {
+		var reader sdkmetric.Reader
+		var err error
+		switch exporterType {
+		case exporterMemory:
+			reader = mem.Metrics
+		case exporterPrometheus:
+			reader, err = newPrometheusReader(cfg, admin)
+		default:
+			var metricExporter sdkmetric.Exporter
+			if metricExporter, err = newMetricExporter(ctx, cfg, exporterType); err == nil {
+				readerOpts := periodicReaderOptions(cfg.processorSettings("metrics", exporterType))
+				if producer := newRuntimeProducer(cfg); producer != nil {
+					readerOpts = append(readerOpts, sdkmetric.WithProducer(producer))
+				}
+				reader = sdkmetric.NewPeriodicReader(
+					&namedMetricExporter{
+						Exporter: metricExporter,
+						name:     exporterType,
+						observer: pipeline.newExportObserver("metrics", exporterType),
+						enabled:  controls.exporterEnabled("metrics"),
+					},
+					readerOpts...,
+				)
+			}
+		}
+		if err != nil {
+			for _, r := range readers {
+				err = errors.Join(err, r.Shutdown(ctx))
+			}
+			return nil, err
+		}
+
+		readers = append(readers, reader)
+		opts = append(opts, sdkmetric.WithReader(reader))
+	}
+
+	return sdkmetric.NewMeterProvider(opts...), nil
+}
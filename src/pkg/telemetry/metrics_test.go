@@ -0,0 +1,170 @@
+package telemetry
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnableExemplars(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		env        map[string]string
+		filter     string
+		setEnv     bool
+		wantFilter string
+		wantEnv    map[string]string
+	}{
+		{
+			name:       "default",
+			setEnv:     true,
+			filter:     exemplarFilterTraceBased,
+			wantFilter: exemplarFilterTraceBased,
+			wantEnv:    map[string]string{"OTEL_GO_X_EXEMPLAR": "true"},
+		},
+		{
+			name:       "always on",
+			setEnv:     true,
+			filter:     exemplarFilterAlwaysOn,
+			wantFilter: exemplarFilterAlwaysOn,
+			wantEnv:    map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_on", "OTEL_GO_X_EXEMPLAR": "true"},
+		},
+		{
+			name:       "always off",
+			setEnv:     true,
+			filter:     exemplarFilterAlwaysOff,
+			wantFilter: exemplarFilterAlwaysOff,
+			wantEnv:    map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_off"},
+		},
+		{
+			name:       "filter set by the user",
+			env:        map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_off"},
+			setEnv:     true,
+			filter:     exemplarFilterAlwaysOn,
+			wantFilter: exemplarFilterAlwaysOff,
+			wantEnv:    map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_off"},
+		},
+		{
+			name:       "feature disabled by the user",
+			env:        map[string]string{"OTEL_GO_X_EXEMPLAR": "false"},
+			setEnv:     true,
+			filter:     exemplarFilterAlwaysOn,
+			wantFilter: exemplarFilterAlwaysOff,
+			wantEnv:    map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_on", "OTEL_GO_X_EXEMPLAR": "false"},
+		},
+		{
+			name:       "environment left to the user",
+			filter:     exemplarFilterAlwaysOn,
+			wantFilter: exemplarFilterAlwaysOff,
+		},
+		{
+			name:       "feature enabled by the user",
+			env:        map[string]string{"OTEL_GO_X_EXEMPLAR": "true"},
+			filter:     exemplarFilterAlwaysOn,
+			wantFilter: exemplarFilterTraceBased,
+			wantEnv:    map[string]string{"OTEL_GO_X_EXEMPLAR": "true"},
+		},
+		{
+			name:       "filter and feature set by the user",
+			env:        map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_on", "OTEL_GO_X_EXEMPLAR": "true"},
+			filter:     exemplarFilterTraceBased,
+			wantFilter: exemplarFilterAlwaysOn,
+			wantEnv:    map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": "always_on", "OTEL_GO_X_EXEMPLAR": "true"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exemplarEnv.values = map[string]string{}
+			// t.Setenv restores the variables, and the unset ones are unset once more below
+			for _, name := range exemplarVars {
+				t.Setenv(name, tc.env[name])
+				if _, ok := tc.env[name]; !ok {
+					_ = os.Unsetenv(name)
+				}
+			}
+
+			filter, restore, err := enableExemplars(tc.filter, tc.setEnv)
+			if err != nil {
+				t.Fatalf("enableExemplars failed: %v", err)
+			}
+			if filter != tc.wantFilter {
+				t.Errorf("enableExemplars returned filter %q, want %q", filter, tc.wantFilter)
+			}
+			checkExemplarEnv(t, tc.wantEnv)
+
+			// the environment is left as the user set it once restored
+			if err := restore(); err != nil {
+				t.Fatalf("restore failed: %v", err)
+			}
+			checkExemplarEnv(t, tc.env)
+		})
+	}
+}
+
+func checkExemplarEnv(t *testing.T, want map[string]string) {
+	t.Helper()
+
+	for _, name := range exemplarVars {
+		value, ok := os.LookupEnv(name)
+		wantValue, wantOK := want[name]
+		if ok != wantOK || value != wantValue {
+			t.Errorf("%s = %q (set: %t), want %q (set: %t)", name, value, ok, wantValue, wantOK)
+		}
+	}
+}
+
+func TestEnableExemplarsAgain(t *testing.T) {
+	// a later Init changes the variables set by an earlier one, which are not the user's
+	exemplarEnv.values = map[string]string{}
+	for _, name := range exemplarVars {
+		t.Setenv(name, "")
+		_ = os.Unsetenv(name)
+	}
+
+	_, restoreFirst, err := enableExemplars(exemplarFilterAlwaysOn, true)
+	if err != nil {
+		t.Fatalf("enableExemplars failed: %v", err)
+	}
+	filter, restoreSecond, err := enableExemplars(exemplarFilterAlwaysOff, true)
+	if err != nil {
+		t.Fatalf("enableExemplars failed: %v", err)
+	}
+	if filter != exemplarFilterAlwaysOff {
+		t.Errorf("enableExemplars returned filter %q, want %q", filter, exemplarFilterAlwaysOff)
+	}
+	// OTEL_GO_X_EXEMPLAR is unset once exemplars are off
+	checkExemplarEnv(t, map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": exemplarFilterAlwaysOff})
+
+	// shutting down the second restores the variables of the first, which are still not the user's
+	if err := restoreSecond(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	checkExemplarEnv(t, map[string]string{
+		"OTEL_METRICS_EXEMPLAR_FILTER": exemplarFilterAlwaysOn,
+		"OTEL_GO_X_EXEMPLAR":           "true",
+	})
+	if _, ok := userEnv("OTEL_GO_X_EXEMPLAR"); ok {
+		t.Errorf("OTEL_GO_X_EXEMPLAR is taken for a variable set by the user once restored")
+	}
+	if err := restoreFirst(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	checkExemplarEnv(t, nil)
+}
+
+func TestRestoreExemplarsChangedByUser(t *testing.T) {
+	// a variable changed after Init set it is left as it is
+	exemplarEnv.values = map[string]string{}
+	for _, name := range exemplarVars {
+		t.Setenv(name, "")
+		_ = os.Unsetenv(name)
+	}
+
+	_, restore, err := enableExemplars(exemplarFilterAlwaysOn, true)
+	if err != nil {
+		t.Fatalf("enableExemplars failed: %v", err)
+	}
+	t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", exemplarFilterTraceBased)
+	if err := restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	checkExemplarEnv(t, map[string]string{"OTEL_METRICS_EXEMPLAR_FILTER": exemplarFilterTraceBased})
+}
@@ -0,0 +1,319 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Option configures the providers constructed by Init
+type Option func(*config)
+
+type config struct {
+	serviceName           string
+	serviceVersion        string
+	deploymentEnvironment string
+	tracesExporters       []string
+	metricsExporters      []string
+	logsExporters         []string
+	sampler               string
+	samplerArg            string
+	routeRatios           map[string]float64
+	samplerDebug          bool
+	propagators           []propagation.TextMapPropagator
+	adminPort             string
+	adminToken            string
+	exportBufferSignals   []string
+	logLevel              string
+	// baggage is nil unless baggage members are copied onto spans and log records
+	baggage            *baggageSettings
+	redactionRulesFile string
+	exemplarFilter     string
+	// exemplarEnv is nil until it is resolved from an option or the environment
+	exemplarEnv *bool
+	// runtimeMetrics and processMetrics are nil until they are resolved from an option or the environment
+	runtimeMetrics *bool
+	processMetrics *bool
+	// configFile holds the settings of the configuration file, or nil when there is none
+	configFile *configFileSettings
+	disabled   bool
+}
+
+func newConfig(opts ...Option) (*config, error) {
+	/*
+		build a config by applying each option in order. anything not set through an option is read
+		from the environment, then from the configuration file named by OTEL_CONFIG_FILE, and finally
+		falls back to its default value
+	*/
+
+	file, err := loadedConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{configFile: file}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.propagators == nil {
+		if cfg.propagators, err = propagatorsFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	cfg.applyEnv()
+	if cfg.exemplarFilter, err = parseExemplarFilter(cfg.exemplarFilter); err != nil {
+		return nil, fmt.Errorf("invalid exemplar filter: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func (cfg *config) processorSettings(signal string, exporterType string) *processorSettings {
+	/*
+		return the processor settings the configuration file gives to an exporter, or nil
+	*/
+
+	if cfg.configFile == nil {
+		return nil
+	}
+	return cfg.configFile.processors[signal][exporterType]
+}
+
+func (cfg *config) fileResourceAttributes() []attribute.KeyValue {
+	/*
+		return the resource attributes of the configuration file, if any
+	*/
+
+	if cfg.configFile == nil {
+		return nil
+	}
+	return cfg.configFile.resourceAttributes
+}
+
+func WithServiceName(name string) Option {
+	/*
+		set the service name that is attached to all telemetry emitted by this process. overrides
+		OTEL_SERVICE_NAME
+	*/
+
+	return func(cfg *config) {
+		cfg.serviceName = name
+	}
+}
+
+func WithServiceVersion(version string) Option {
+	/*
+		set the `service.version` resource attribute. overrides the ServiceVersion variable and the
+		version found in the build info of the binary
+	*/
+
+	return func(cfg *config) {
+		cfg.serviceVersion = version
+	}
+}
+
+func WithDeploymentEnvironment(environment string) Option {
+	/*
+		set the `deployment.environment` resource attribute, e.g. `staging` or `production`. a value
+		in OTEL_RESOURCE_ATTRIBUTES takes precedence
+	*/
+
+	return func(cfg *config) {
+		cfg.deploymentEnvironment = environment
+	}
+}
+
+func WithTracesExporter(exporterTypes ...string) Option {
+	/*
+		set the exporters used for traces. each one of `otlp`, `otlphttp`, `console`, `file`, `memory`
+		or `none`, or their aliases `otel`, `stdout` and `noop`. every exporter receives all traces
+		through its own processor. overrides OTEL_TRACES_EXPORTER
+	*/
+
+	return func(cfg *config) {
+		cfg.tracesExporters = exporterTypes
+	}
+}
+
+func WithMetricsExporter(exporterTypes ...string) Option {
+	/*
+		set the exporters used for metrics. each one of `otlp`, `otlphttp`, `console`, `file`,
+		`memory`, `prometheus` or `none`, or their aliases `otel`, `stdout` and `noop`. every exporter
+		receives all metrics through its own reader. overrides OTEL_METRICS_EXPORTER
+	*/
+
+	return func(cfg *config) {
+		cfg.metricsExporters = exporterTypes
+	}
+}
+
+func WithLogsExporter(exporterTypes ...string) Option {
+	/*
+		set the exporters used for logs. each one of `otlp`, `otlphttp`, `console`, `file`, `memory`
+		or `none`, or their aliases `otel`, `stdout` and `noop`. every exporter receives all logs
+		through its own processor. overrides OTEL_LOGS_EXPORTER
+	*/
+
+	return func(cfg *config) {
+		cfg.logsExporters = exporterTypes
+	}
+}
+
+func WithTracesSampler(sampler string, arg string) Option {
+	/*
+		set the trace sampler, using the names and argument format of OTEL_TRACES_SAMPLER and
+		OTEL_TRACES_SAMPLER_ARG, e.g. WithTracesSampler("parentbased_traceidratio", "0.1"). overrides
+		both environment variables
+	*/
+
+	return func(cfg *config) {
+		cfg.sampler = sampler
+		cfg.samplerArg = arg
+	}
+}
+
+func WithRouteSamplingRatios(routeRatios map[string]float64) Option {
+	/*
+		sample root spans for the given HTTP routes at their own ratio instead of the ratio of the
+		configured sampler, e.g. {"/": 0.01}. overrides TRACES_SAMPLER_ROUTES
+	*/
+
+	return func(cfg *config) {
+		cfg.routeRatios = routeRatios
+	}
+}
+
+func WithSamplerDebug(enabled bool) Option {
+	/*
+		record the sampler description and decision as attributes on every sampled span. may also be
+		enabled by setting TRACES_SAMPLER_DEBUG to `true`
+	*/
+
+	return func(cfg *config) {
+		cfg.samplerDebug = enabled
+	}
+}
+
+func WithPropagators(propagators ...propagation.TextMapPropagator) Option {
+	/*
+		set the propagators that are combined into the global text map propagator. overrides
+		OTEL_PROPAGATORS, which defaults to W3C TraceContext and Baggage
+	*/
+
+	return func(cfg *config) {
+		cfg.propagators = propagators
+	}
+}
+
+func WithBaggageAttributes(keys ...string) Option {
+	/*
+		copy the baggage members with the given keys onto every span, and onto every log record written
+		through Ctx. a key ending in `*` matches every key with that prefix. overrides BAGGAGE_ATTRIBUTES
+	*/
+
+	return func(cfg *config) {
+		cfg.baggage = parseBaggageSettings(
+			strings.Join(keys, ","),
+			os.Getenv("BAGGAGE_ATTRIBUTES_MAX_LENGTH"),
+			os.Getenv("BAGGAGE_ATTRIBUTES_PREFIX"),
+		)
+	}
+}
+
+func WithRedactionRulesFile(path string) Option {
+	/*
+		redact spans and log records according to the rules in the YAML file at `path` before they
+		are exported. overrides REDACTION_RULES_FILE
+	*/
+
+	return func(cfg *config) {
+		cfg.redactionRulesFile = path
+	}
+}
+
+func WithExemplarFilter(filter string) Option {
+	/*
+		select the measurements recorded as exemplars: `trace_based`, the default, `always_on` or
+		`always_off`. overrides the configuration file. the metrics SDK in use (v1.25.0) only reads
+		the filter from OTEL_METRICS_EXEMPLAR_FILTER, and records exemplars at all only when
+		OTEL_GO_X_EXEMPLAR is `true`, so the filter is only applied when WithExemplarEnv lets Init set
+		both. a variable set by the user takes precedence over this option
+	*/
+
+	return func(cfg *config) {
+		cfg.exemplarFilter = filter
+	}
+}
+
+func WithExemplarEnv(enabled bool) Option {
+	/*
+		let Init set OTEL_GO_X_EXEMPLAR and OTEL_METRICS_EXEMPLAR_FILTER in the environment of the
+		process, so that exemplars are recorded according to the exemplar filter. the variables are
+		inherited by child processes until Shutdown restores them, and are never overwritten when set
+		by the user. without it, exemplars are only recorded when the user sets OTEL_GO_X_EXEMPLAR to
+		`true`. overrides EXEMPLAR_ENV_ENABLED
+	*/
+
+	return func(cfg *config) {
+		cfg.exemplarEnv = &enabled
+	}
+}
+
+func WithRuntimeMetrics(enabled bool) Option {
+	/*
+		enable or disable the metrics of the Go runtime, such as heap usage, goroutines, scheduling
+		latency and GC pauses. overrides RUNTIME_METRICS_ENABLED
+	*/
+
+	return func(cfg *config) {
+		cfg.runtimeMetrics = &enabled
+	}
+}
+
+func WithProcessMetrics(enabled bool) Option {
+	/*
+		enable or disable the metrics of the process, such as CPU time, resident memory and open file
+		descriptors. overrides PROCESS_METRICS_ENABLED
+	*/
+
+	return func(cfg *config) {
+		cfg.processMetrics = &enabled
+	}
+}
+
+func WithAdminPort(port string) Option {
+	/*
+		set the port of the admin server, which serves endpoints such as the Prometheus `/metrics`
+		endpoint apart from the public router of the service. overrides ADMIN_PORT
+	*/
+
+	return func(cfg *config) {
+		cfg.adminPort = port
+	}
+}
+
+func WithAdminToken(token string) Option {
+	/*
+		set the bearer token required by the admin API. the API is only served when a token is set.
+		overrides ADMIN_TOKEN
+	*/
+
+	return func(cfg *config) {
+		cfg.adminToken = token
+	}
+}
+
+func WithExportBuffer(signals ...string) Option {
+	/*
+		buffer failed OTLP export batches of the given signals (`traces`, `metrics` and/or `logs`) on
+		disk, and replay them once the collector is reachable again. overrides EXPORT_BUFFER_SIGNALS
+	*/
+
+	return func(cfg *config) {
+		cfg.exportBufferSignals = signals
+	}
+}
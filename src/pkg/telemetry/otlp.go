@@ -0,0 +1,274 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// protocols accepted by OTEL_EXPORTER_OTLP_PROTOCOL and its per-signal variants
+const (
+	protocolGRPC         = "grpc"
+	protocolHTTPProtobuf = "http/protobuf"
+)
+
+// compression accepted by OTEL_EXPORTER_OTLP_COMPRESSION and its per-signal variants
+const (
+	compressionGzip = "gzip"
+	compressionNone = "none"
+)
+
+// otlpSettings describes how the OTLP exporter for a single signal connects to the collector
+type otlpSettings struct {
+	protocol string
+	// endpoint is the host and port of the collector, without a scheme
+	endpoint string
+	// urlPath is only used by the http/protobuf protocol
+	urlPath  string
+	insecure bool
+	// explicitScheme is set when the endpoint was given as a URL rather than a bare `host:port`
+	explicitScheme bool
+	// tlsConfig is nil when connecting without TLS
+	tlsConfig   *tls.Config
+	headers     map[string]string
+	compression string
+	// timeout bounds a single export, zero leaves the default of the exporter in place
+	timeout time.Duration
+	// withoutRetry disables the retries of the exporter, for when failed batches are buffered on disk and
+	// replayed instead
+	withoutRetry bool
+	// temporality and aggregation are only set for metric exporters, nil leaves the SDK defaults in place
+	temporality sdkmetric.TemporalitySelector
+	aggregation sdkmetric.AggregationSelector
+}
+
+func otlpEnv(signal string, suffix string) (string, bool) {
+	/*
+		look up an OTEL_EXPORTER_OTLP_* setting for `signal`. the per-signal variable, e.g.
+		OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, takes precedence over the generic one, and both take
+		precedence over the exporter settings of the configuration file. the returned bool reports
+		whether a per-signal value was used
+	*/
+
+	name := fmt.Sprintf("OTEL_EXPORTER_OTLP_%s_%s", strings.ToUpper(signal), suffix)
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value, true
+	}
+	if value := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_" + suffix)); value != "" {
+		return value, false
+	}
+
+	return configFileEnv(name), true
+}
+
+func otlpProtocol(signal string, exporterType string) string {
+	/*
+		return the OTLP protocol requested for `signal`, which is not necessarily a supported one
+	*/
+
+	if exporterType == exporterOTLPHTTP {
+		return protocolHTTPProtobuf
+	}
+	if protocol, _ := otlpEnv(signal, "PROTOCOL"); protocol != "" {
+		return strings.ToLower(protocol)
+	}
+	return protocolGRPC
+}
+
+func resolveOTLPSettings(signal string, exporterType string) (*otlpSettings, error) {
+	/*
+		resolve the protocol, endpoint and URL path used to export `signal` (one of `traces`, `metrics`
+		or `logs`) over OTLP. the `otlphttp` exporter type always selects http/protobuf, while `otlp`
+		honors OTEL_EXPORTER_OTLP_PROTOCOL and defaults to grpc.
+
+		endpoints may be given as URLs, per the specification, or as a bare `host:port` as historically
+		used by this repository. a bare endpoint, or one with the `http` scheme, connects without TLS.
+		for http/protobuf, `/v1/<signal>` is appended to the path of the generic endpoint, while a
+		per-signal endpoint is used as-is
+	*/
+
+	settings := &otlpSettings{
+		protocol: otlpProtocol(signal, exporterType),
+		urlPath:  "/v1/" + signal,
+	}
+	if settings.protocol != protocolGRPC && settings.protocol != protocolHTTPProtobuf {
+		return nil, fmt.Errorf(
+			"unsupported OTLP protocol %q for %s, must be one of `%s` or `%s`",
+			settings.protocol, signal, protocolGRPC, protocolHTTPProtobuf,
+		)
+	}
+
+	endpoint, signalSpecific := otlpEnv(signal, "ENDPOINT")
+	if endpoint == "" {
+		return nil, fmt.Errorf(
+			"%s exporter set to `%s` but neither OTEL_EXPORTER_OTLP_%s_ENDPOINT nor "+
+				"OTEL_EXPORTER_OTLP_ENDPOINT is set",
+			signal, exporterType, strings.ToUpper(signal),
+		)
+	}
+
+	var endpointPath string
+	if !strings.Contains(endpoint, "://") {
+		// bare `host:port`, optionally followed by a path
+		settings.insecure = true
+		settings.endpoint, endpointPath, _ = strings.Cut(endpoint, "/")
+		if endpointPath != "" {
+			endpointPath = "/" + endpointPath
+		}
+	} else {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP endpoint %q for %s: %w", endpoint, signal, err)
+		}
+		settings.explicitScheme = true
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			settings.insecure = true
+		case "https":
+		default:
+			return nil, fmt.Errorf("invalid OTLP endpoint %q for %s: scheme must be http or https", endpoint, signal)
+		}
+		settings.endpoint, endpointPath = u.Host, u.Path
+	}
+
+	if settings.protocol == protocolHTTPProtobuf && endpointPath != "" && endpointPath != "/" {
+		if signalSpecific {
+			settings.urlPath = endpointPath
+		} else {
+			settings.urlPath = path.Join(endpointPath, "v1", signal)
+		}
+	}
+
+	if err := settings.applyTransportEnv(signal); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (settings *otlpSettings) applyTransportEnv(signal string) error {
+	/*
+		read headers, TLS certificates, compression and timeout for `signal` from the OTEL_EXPORTER_OTLP_*
+		variables, each of which may be overridden per signal. a bare `host:port` endpoint switches to
+		TLS when a certificate is configured or OTEL_EXPORTER_OTLP_INSECURE is `false`
+	*/
+
+	var err error
+	if value, _ := otlpEnv(signal, "HEADERS"); value != "" {
+		if settings.headers, err = parseOTLPHeaders(value); err != nil {
+			return fmt.Errorf("invalid OTLP headers for %s: %w", signal, err)
+		}
+	}
+
+	if value, _ := otlpEnv(signal, "COMPRESSION"); value != "" {
+		settings.compression = strings.ToLower(value)
+		if settings.compression != compressionGzip && settings.compression != compressionNone {
+			return fmt.Errorf(
+				"unsupported OTLP compression %q for %s, must be one of `%s` or `%s`",
+				value, signal, compressionGzip, compressionNone,
+			)
+		}
+	}
+
+	if value, _ := otlpEnv(signal, "TIMEOUT"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms <= 0 {
+			return fmt.Errorf("invalid OTLP timeout %q for %s, must be a positive number of milliseconds", value, signal)
+		}
+		settings.timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	caFile, _ := otlpEnv(signal, "CERTIFICATE")
+	certFile, _ := otlpEnv(signal, "CLIENT_CERTIFICATE")
+	keyFile, _ := otlpEnv(signal, "CLIENT_KEY")
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf(
+			"OTLP client certificate and key for %s must be set together, got certificate %q and key %q",
+			signal, certFile, keyFile,
+		)
+	}
+
+	if insecure, _ := otlpEnv(signal, "INSECURE"); strings.EqualFold(insecure, "false") || caFile != "" || certFile != "" {
+		if settings.insecure && settings.explicitScheme {
+			log.Printf("telemetry: OTLP endpoint for %s uses http, ignoring TLS settings\n", signal)
+		} else {
+			settings.insecure = false
+		}
+	}
+	if settings.insecure {
+		return nil
+	}
+
+	settings.tlsConfig, err = newOTLPTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS for OTLP %s exporter: %w", signal, err)
+	}
+	return nil
+}
+
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	/*
+		parse a comma separated list of `key=value` pairs with URL encoded values, as used by
+		OTEL_EXPORTER_OTLP_HEADERS, e.g. `authorization=Bearer%20token,x-tenant=a`
+	*/
+
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		key, encoded, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("entry %q must be of the form `key=value`", entry)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("value of %q is not URL encoded: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+
+	return headers, nil
+}
+
+func newOTLPTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	/*
+		construct the TLS configuration used to connect to the collector. the server certificate is
+		verified against caFile if set, and the system roots otherwise. a client certificate is
+		presented for mutual TLS if certFile and keyFile are set
+	*/
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate %s: %w", caFile, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in %s", caFile)
+		}
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s and key %s: %w", certFile, keyFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,279 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// testCertificate is a certificate along with its PEM encoded files
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	tls      tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+func issueCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	/*
+		create a certificate from `template`, signed by `parent` or self-signed if nil, and write its
+		certificate and key as PEM files to a temporary directory
+	*/
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	c := &testCertificate{
+		cert:     cert,
+		key:      key,
+		tls:      tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	writePEM(t, c.certFile, "CERTIFICATE", der)
+	writePEM(t, c.keyFile, "EC PRIVATE KEY", keyDER)
+	return c
+}
+
+func writePEM(t *testing.T, name string, blockType string, der []byte) {
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+// testPKI is a certificate authority, along with a server and a client certificate it signed
+type testPKI struct {
+	ca     *testCertificate
+	server *testCertificate
+	client *testCertificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	ca := issueCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test collector CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	return &testPKI{
+		ca: ca,
+		server: issueCertificate(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "collector"},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca),
+		client: issueCertificate(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "service"},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca),
+	}
+}
+
+func newTLSCollector(t *testing.T, pki *testPKI, requireClientCert bool) (*httptest.Server, *atomic.Int32) {
+	/*
+		start a stand-in for an OTLP/HTTP collector, which counts the trace exports it receives. with
+		`requireClientCert` it only accepts connections presenting a client certificate signed by the CA
+	*/
+
+	var exports atomic.Int32
+	collector := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	collector.TLS = &tls.Config{Certificates: []tls.Certificate{pki.server.tls}}
+	if requireClientCert {
+		collector.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		collector.TLS.ClientCAs = x509.NewCertPool()
+		collector.TLS.ClientCAs.AddCert(pki.ca.cert)
+	}
+	// silence the handshake failures that some of the tests provoke
+	collector.Config.ErrorLog = log.New(io.Discard, "", 0)
+	collector.StartTLS()
+	t.Cleanup(collector.Close)
+
+	return collector, &exports
+}
+
+func exportTraces(t *testing.T) error {
+	/*
+		resolve the OTLP settings for traces from the environment and upload an empty batch with them
+	*/
+
+	settings, err := resolveOTLPSettings("traces", exporterOTLPHTTP)
+	if err != nil {
+		t.Fatalf("failed to resolve OTLP settings: %v", err)
+	}
+	settings.withoutRetry = true
+
+	client := newOTLPTraceClient(settings)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Start(ctx); err != nil {
+		t.Fatalf("failed to start OTLP client: %v", err)
+	}
+	defer func() { _ = client.Stop(context.Background()) }()
+
+	return client.UploadTraces(ctx, []*tracepb.ResourceSpans{{}})
+}
+
+func TestOTLPTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	for _, tc := range []struct {
+		name              string
+		requireClientCert bool
+		env               map[string]string
+		wantErr           string
+	}{
+		{
+			name: "CA only",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": pki.ca.certFile},
+		},
+		{
+			name: "untrusted server",
+			// the system roots do not include the test CA
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_INSECURE": "false"},
+			wantErr: "certificate",
+		},
+		{
+			name:              "client certificate",
+			requireClientCert: true,
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CERTIFICATE":        pki.ca.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE": pki.client.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_KEY":         pki.client.keyFile,
+			},
+		},
+		{
+			name:              "client certificate missing",
+			requireClientCert: true,
+			env:               map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": pki.ca.certFile},
+			wantErr:           "certificate",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			collector, exports := newTLSCollector(t, pki, tc.requireClientCert)
+			// a bare `host:port` endpoint switches to TLS once a certificate or INSECURE=false is set
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", strings.TrimPrefix(collector.URL, "https://"))
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			err := exportTraces(t)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("export failed: %v", err)
+				}
+				if got := exports.Load(); got != 1 {
+					t.Errorf("collector received %d exports, want 1", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("export returned %v, want an error mentioning %q", err, tc.wantErr)
+			}
+			if got := exports.Load(); got != 0 {
+				t.Errorf("collector received %d exports, want 0", got)
+			}
+		})
+	}
+}
+
+func TestOTLPTLSInvalidFiles(t *testing.T) {
+	pki := newTestPKI(t)
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", notPEM, err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "unreadable CA",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": missing},
+			wantErr: "failed to read certificate " + missing,
+		},
+		{
+			name:    "CA without certificates",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_CERTIFICATE": notPEM},
+			wantErr: "no PEM encoded certificates found in " + notPEM,
+		},
+		{
+			name: "unreadable client certificate",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE": missing,
+				"OTEL_EXPORTER_OTLP_CLIENT_KEY":         pki.client.keyFile,
+			},
+			wantErr: "failed to load client certificate " + missing,
+		},
+		{
+			name:    "client certificate without key",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_TRACES_CLIENT_CERTIFICATE": pki.client.certFile},
+			wantErr: "must be set together",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://collector:4318")
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := resolveOTLPSettings("traces", exporterOTLPHTTP)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("resolveOTLPSettings returned %v, want an error mentioning %q", err, tc.wantErr)
+			}
+		})
+	}
+}
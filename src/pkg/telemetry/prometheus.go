@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func newPrometheusReader(cfg *config, admin *adminServer) (sdkmetric.Reader, error) {
+	/*
+		construct a reader that serves metrics in the Prometheus exposition format on `/metrics` of the
+		admin server. metric names are sanitized for Prometheus, e.g. `entrypoint.hello.requests` with
+		unit `{request}` is exposed as `entrypoint_hello_requests_total`, and known units such as `s`
+		or `By` are appended as `_seconds` or `_bytes`. a dedicated registry is used, so that only the
+		metrics recorded through the meter provider are exposed. exemplars are only part of the
+		OpenMetrics format, which is served to scrapers that ask for it in their Accept header
+	*/
+
+	registry := prometheus.NewRegistry()
+	opts := []otelprometheus.Option{otelprometheus.WithRegisterer(&gaugeExemplarRegisterer{registry})}
+	if producer := newRuntimeProducer(cfg); producer != nil {
+		opts = append(opts, otelprometheus.WithProducer(producer))
+	}
+	exporter, err := otelprometheus.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Prometheus exporter: %w", err)
+	}
+
+	admin.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+
+	return exporter, nil
+}
+
+// gaugeExemplarRegisterer registers collectors wrapped in a gaugeExemplarCollector. the Prometheus exporter
+// attaches exemplars to every sum, including those of up-down counters, which it exposes as gauges. Prometheus
+// only allows exemplars on counters and histograms, and fails the whole scrape otherwise
+type gaugeExemplarRegisterer struct {
+	prometheus.Registerer
+}
+
+func (r *gaugeExemplarRegisterer) Register(c prometheus.Collector) error {
+	return r.Registerer.Register(&gaugeExemplarCollector{c})
+}
+
+func (r *gaugeExemplarRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// gaugeExemplarCollector drops the exemplars of the gauges collected by the wrapped collector
+type gaugeExemplarCollector struct {
+	prometheus.Collector
+}
+
+func (c *gaugeExemplarCollector) Collect(ch chan<- prometheus.Metric) {
+	/*
+		pass on every metric of the wrapped collector. a gauge that cannot be written because of its
+		exemplars is still written in full before the exemplars are rejected, so it is passed on as
+		written instead
+	*/
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		written := &dto.Metric{}
+		if err := m.Write(written); err != nil && written.Gauge != nil {
+			m = &writtenMetric{desc: m.Desc(), written: written}
+		}
+		ch <- m
+	}
+}
+
+// writtenMetric is a metric that has already been written
+type writtenMetric struct {
+	desc    *prometheus.Desc
+	written *dto.Metric
+}
+
+func (m *writtenMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *writtenMetric) Write(out *dto.Metric) error {
+	out.Label, out.Gauge, out.TimestampMs = m.written.Label, m.written.Gauge, m.written.TimestampMs
+	return nil
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// propagatorsByName holds the propagators that may be selected by name, using the names of OTEL_PROPAGATORS
+var propagatorsByName = map[string]propagation.TextMapPropagator{
+	"tracecontext": propagation.TraceContext{},
+	"baggage":      propagation.Baggage{},
+	// b3 injects the single `b3` header and b3multi the `X-B3-*` headers. both extract either format
+	"b3":      b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)),
+	"b3multi": b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+	"jaeger":  jaeger.Jaeger{},
+	"xray":    xray.Propagator{},
+}
+
+// defaultPropagators are used when neither an option, OTEL_PROPAGATORS nor the configuration file select any
+var defaultPropagators = []string{"tracecontext", "baggage"}
+
+func newPropagators(names []string) ([]propagation.TextMapPropagator, error) {
+	/*
+		resolve a list of propagator names, e.g. `tracecontext` and `baggage`, in order. `none` selects
+		no propagator at all
+	*/
+
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "none" {
+			continue
+		}
+
+		propagator, ok := propagatorsByName[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported propagator %q, must be one of %s", name, supportedPropagators())
+		}
+		propagators = append(propagators, propagator)
+	}
+
+	return propagators, nil
+}
+
+func propagatorName(propagator propagation.TextMapPropagator) string {
+	/*
+		return the name under which `propagator` can be selected, or its type for one that was passed
+		through WithPropagators
+	*/
+
+	for name, known := range propagatorsByName {
+		if reflect.DeepEqual(known, propagator) {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", propagator)
+}
+
+func supportedPropagators() string {
+	names := make([]string, 0, len(propagatorsByName)+1)
+	for name := range propagatorsByName {
+		names = append(names, "`"+name+"`")
+	}
+	slices.Sort(names)
+	return strings.Join(append(names, "`none`"), ", ")
+}
@@ -0,0 +1,534 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	sdklogs "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redaction actions
+const (
+	redactDrop = "drop"
+	redactHash = "hash"
+	redactMask = "mask"
+)
+
+// defaultMaskReplacement replaces the matches of a mask rule that does not set its own replacement
+const defaultMaskReplacement = "[REDACTED]"
+
+// redactionPreset is a pattern that a mask rule can refer to by name. when validate is set, only the matches it
+// accepts are masked
+type redactionPreset struct {
+	pattern  string
+	validate func(string) bool
+}
+
+// redactionPresets are the patterns that a mask rule can refer to by name instead of spelling out a regular expression
+var redactionPresets = map[string]redactionPreset{
+	"email": {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	// 13 to 19 digits, optionally separated by spaces or dashes, that pass the Luhn check. other numbers of that
+	// length, such as timestamps in nanoseconds or numeric IDs, are left alone
+	"credit_card":  {pattern: `\b(?:\d[ -]?){12,18}\d\b`, validate: luhnValid},
+	"bearer_token": {pattern: `(?i)bearer\s+[A-Za-z0-9._~+/=-]+`},
+	"jwt":          {pattern: `eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`},
+}
+
+func luhnValid(number string) bool {
+	/*
+		report whether the digits of `number`, ignoring spaces and dashes, have a valid Luhn check digit
+	*/
+
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] == ' ' || number[i] == '-' {
+			continue
+		}
+		digit := int(number[i] - '0')
+		if digits%2 == 1 {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
+
+// redactionRulesFile is the format of the file named by REDACTION_RULES_FILE
+type redactionRulesFile struct {
+	Rules []redactionRuleConfig `yaml:"rules"`
+}
+
+type redactionRuleConfig struct {
+	Name        string   `yaml:"name"`
+	Action      string   `yaml:"action"`
+	Keys        []string `yaml:"keys"`
+	Pattern     string   `yaml:"pattern"`
+	Preset      string   `yaml:"preset"`
+	Replacement *string  `yaml:"replacement"`
+	Salt        string   `yaml:"salt"`
+}
+
+// redactionRule is a single, validated rule. rules apply to every attribute whose key matches one of keys, or to
+// every attribute, as well as log bodies, span names, span status descriptions and span event names, when a mask
+// rule lists no keys at all
+type redactionRule struct {
+	name        string
+	action      string
+	keys        []string
+	allKeys     bool
+	pattern     *regexp.Regexp
+	validate    func(string) bool
+	replacement string
+	salt        string
+	// body is set for mask rules that also apply to the body of log records
+	body bool
+}
+
+func loadRedactionRules(path string) ([]*redactionRule, error) {
+	/*
+		read and validate the redaction rules in the YAML file at `path`
+	*/
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read REDACTION_RULES_FILE: %w", err)
+	}
+	rules, err := parseRedactionRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDACTION_RULES_FILE %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func parseRedactionRules(data []byte) ([]*redactionRule, error) {
+	var file redactionRulesFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(file.Rules))
+	rules := make([]*redactionRule, 0, len(file.Rules))
+	for i, r := range file.Rules {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("rules[%d]: %s", i, fmt.Sprintf(format, args...))
+		}
+
+		if r.Name == "" {
+			return nil, fail("name is required")
+		}
+		if names[r.Name] {
+			return nil, fail("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		rule := &redactionRule{name: r.Name, action: strings.ToLower(r.Action), salt: r.Salt}
+		for _, key := range r.Keys {
+			if key = strings.TrimSpace(key); key == "body" {
+				rule.body = true
+			} else if key != "" {
+				rule.keys = append(rule.keys, key)
+			}
+		}
+
+		switch rule.action {
+		case redactDrop, redactHash:
+			if len(rule.keys) == 0 {
+				return nil, fail("a %s rule requires attribute keys", rule.action)
+			}
+			if rule.body {
+				return nil, fail("a %s rule cannot apply to the log body, only a mask rule can", rule.action)
+			}
+			if r.Pattern != "" || r.Preset != "" || r.Replacement != nil {
+				return nil, fail("pattern, preset and replacement are only supported by mask rules")
+			}
+		case redactMask:
+			if r.Pattern != "" && r.Preset != "" {
+				return nil, fail("set either pattern or preset, not both")
+			}
+			pattern := r.Pattern
+			if r.Preset != "" {
+				preset, ok := redactionPresets[r.Preset]
+				if !ok {
+					return nil, fail("unknown preset %q, must be one of %s", r.Preset, redactionPresetNames())
+				}
+				pattern, rule.validate = preset.pattern, preset.validate
+			}
+			if pattern == "" && len(rule.keys) == 0 {
+				return nil, fail("a mask rule without a pattern or preset requires attribute keys")
+			}
+			if pattern != "" {
+				var err error
+				if rule.pattern, err = regexp.Compile(pattern); err != nil {
+					return nil, fail("invalid pattern: %v", err)
+				}
+			}
+			// a rule without keys applies to log bodies and span names as well as to every attribute
+			rule.allKeys = len(r.Keys) == 0
+			rule.body = rule.body || rule.allKeys
+			rule.replacement = defaultMaskReplacement
+			if r.Replacement != nil {
+				rule.replacement = *r.Replacement
+			}
+		default:
+			return nil, fail("unsupported action %q, must be one of `drop`, `hash` or `mask`", r.Action)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func redactionPresetNames() string {
+	names := make([]string, 0, len(redactionPresets))
+	for name := range redactionPresets {
+		names = append(names, "`"+name+"`")
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+func matchesKey(patterns []string, key string) bool {
+	/*
+		report whether `key` equals one of `patterns`, or starts with the prefix of a pattern ending in `*`
+	*/
+
+	for _, pattern := range patterns {
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if pattern == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactionRule) applies(key attribute.Key) bool {
+	return r.allKeys || matchesKey(r.keys, string(key))
+}
+
+func (r *redactionRule) appliesToText(logBody bool) bool {
+	return r.allKeys || logBody && r.body
+}
+
+func (r *redactionRule) redactValue(value string) (string, bool) {
+	switch r.action {
+	case redactHash:
+		sum := sha256.Sum256([]byte(r.salt + value))
+		return "sha256:" + hex.EncodeToString(sum[:]), true
+	default:
+		if r.pattern == nil {
+			return r.replacement, true
+		}
+		redacted := r.mask(value)
+		return redacted, redacted != value
+	}
+}
+
+func (r *redactionRule) mask(value string) string {
+	/*
+		replace the matches of the pattern in `value`, skipping those that the validation of a preset rejects
+	*/
+
+	if r.validate == nil {
+		return r.pattern.ReplaceAllString(value, r.replacement)
+	}
+
+	var redacted []byte
+	last := 0
+	for _, match := range r.pattern.FindAllStringSubmatchIndex(value, -1) {
+		if !r.validate(value[match[0]:match[1]]) {
+			continue
+		}
+		redacted = append(redacted, value[last:match[0]]...)
+		redacted = r.pattern.ExpandString(redacted, r.replacement, value, match)
+		last = match[1]
+	}
+	if last == 0 {
+		return value
+	}
+	return string(append(redacted, value[last:]...))
+}
+
+// redactor applies redaction rules to spans and log records before they are exported, and counts every value
+// it redacts by rule once its counter is created by start
+type redactor struct {
+	rules      []*redactionRule
+	redactions atomic.Pointer[metric.Int64Counter]
+}
+
+func newRedactor(cfg *config) (*redactor, error) {
+	/*
+		load the rules of cfg.redactionRulesFile, or return nil if there is none
+	*/
+
+	if cfg.redactionRulesFile == "" {
+		return nil, nil
+	}
+	rules, err := loadRedactionRules(cfg.redactionRulesFile)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	return &redactor{rules: rules}, nil
+}
+
+func (r *redactor) start(mp metric.MeterProvider) error {
+	/*
+		create the counter of redactions on `mp`, which is constructed after the processors that redact
+	*/
+
+	redactions, err := mp.Meter(instrumentationName).Int64Counter("telemetry.redactions",
+		metric.WithDescription("The number of attribute values, log bodies and span names redacted before export"),
+		metric.WithUnit("{redaction}"),
+	)
+	if err != nil {
+		return err
+	}
+	r.redactions.Store(&redactions)
+	return nil
+}
+
+func (r *redactor) count(signal string, rule *redactionRule) {
+	redactions := r.redactions.Load()
+	if redactions == nil {
+		return
+	}
+	(*redactions).Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("rule", rule.name),
+		attribute.String("signal", signal),
+	))
+}
+
+func (r *redactor) redactAttributes(signal string, attrs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	/*
+		apply the rules in order to every attribute. a dropped attribute is not seen by later rules. the
+		input is left untouched, and a copy is returned if anything was redacted
+	*/
+
+	var redacted []attribute.KeyValue
+	for i, kv := range attrs {
+		dropped := false
+		for _, rule := range r.rules {
+			if !rule.applies(kv.Key) {
+				continue
+			}
+			if rule.action == redactDrop {
+				dropped = true
+			} else if kv.Value.Type() == attribute.STRING || rule.action == redactHash {
+				value, changed := rule.redactValue(kv.Value.Emit())
+				if !changed {
+					continue
+				}
+				kv = kv.Key.String(value)
+			} else {
+				// mask rules only apply to string values
+				continue
+			}
+
+			r.count(signal, rule)
+			if redacted == nil {
+				redacted = slices.Clone(attrs[:i])
+			}
+			if dropped {
+				break
+			}
+		}
+		if redacted != nil && !dropped {
+			redacted = append(redacted, kv)
+		}
+	}
+
+	if redacted == nil {
+		return attrs, false
+	}
+	return redacted, true
+}
+
+func (r *redactor) redactText(signal string, text string, logBody bool) (string, bool) {
+	/*
+		apply the mask rules without keys to free text, such as a span name. the body of a log record is
+		also masked by the rules that list `body` among their keys
+	*/
+
+	changed := false
+	for _, rule := range r.rules {
+		if !rule.appliesToText(logBody) {
+			continue
+		}
+		if value, ok := rule.redactValue(text); ok {
+			text, changed = value, true
+			r.count(signal, rule)
+		}
+	}
+	return text, changed
+}
+
+// redactedSpan presents the name, status, attributes, events and links of a span after redaction, leaving the span
+// itself untouched
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	name       string
+	status     sdktrace.Status
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+	links      []sdktrace.Link
+}
+
+func (s *redactedSpan) Name() string { return s.name }
+
+func (s *redactedSpan) Status() sdktrace.Status { return s.status }
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue { return s.attributes }
+
+func (s *redactedSpan) Events() []sdktrace.Event { return s.events }
+
+func (s *redactedSpan) Links() []sdktrace.Link { return s.links }
+
+func (r *redactor) redactSpan(span sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	/*
+		return `span` with its name, status description, attributes, and the names and attributes of its
+		events and the attributes of its links redacted, or `span` itself if no rule applied
+	*/
+
+	name, changed := r.redactText("traces", span.Name(), false)
+	status := span.Status()
+	if description, ok := r.redactText("traces", status.Description, false); ok {
+		status.Description, changed = description, true
+	}
+	attrs, attrsChanged := r.redactAttributes("traces", span.Attributes())
+	changed = changed || attrsChanged
+
+	events := span.Events()
+	var redactedEvents []sdktrace.Event
+	for i, event := range events {
+		eventName, nameChanged := r.redactText("traces", event.Name, false)
+		eventAttrs, attrsChanged := r.redactAttributes("traces", event.Attributes)
+		if !nameChanged && !attrsChanged {
+			continue
+		}
+		if redactedEvents == nil {
+			redactedEvents = slices.Clone(events)
+		}
+		redactedEvents[i].Name, redactedEvents[i].Attributes = eventName, eventAttrs
+	}
+
+	links := span.Links()
+	var redactedLinks []sdktrace.Link
+	for i, link := range links {
+		linkAttrs, attrsChanged := r.redactAttributes("traces", link.Attributes)
+		if !attrsChanged {
+			continue
+		}
+		if redactedLinks == nil {
+			redactedLinks = slices.Clone(links)
+		}
+		redactedLinks[i].Attributes = linkAttrs
+	}
+
+	if !changed && redactedEvents == nil && redactedLinks == nil {
+		return span
+	}
+	if redactedEvents == nil {
+		redactedEvents = events
+	}
+	if redactedLinks == nil {
+		redactedLinks = links
+	}
+	return &redactedSpan{
+		ReadOnlySpan: span,
+		name:         name,
+		status:       status,
+		attributes:   attrs,
+		events:       redactedEvents,
+		links:        redactedLinks,
+	}
+}
+
+// redactingSpanProcessor redacts every span once, before handing it to the processors that export it
+type redactingSpanProcessor struct {
+	redactor *redactor
+	next     []sdktrace.SpanProcessor
+}
+
+func (p *redactingSpanProcessor) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	for _, next := range p.next {
+		next.OnStart(ctx, span)
+	}
+}
+
+func (p *redactingSpanProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	redacted := p.redactor.redactSpan(span)
+	for _, next := range p.next {
+		next.OnEnd(redacted)
+	}
+}
+
+func (p *redactingSpanProcessor) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, next := range p.next {
+		errs = append(errs, next.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *redactingSpanProcessor) ForceFlush(ctx context.Context) error {
+	var errs []error
+	for _, next := range p.next {
+		errs = append(errs, next.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// redactingLogProcessor redacts the attributes and body of every log record in place. it is registered ahead
+// of the processors that export log records
+type redactingLogProcessor struct {
+	redactor *redactor
+}
+
+func (p *redactingLogProcessor) OnEmit(record sdklogs.ReadableLogRecord) {
+	if attrs := record.Attributes(); attrs != nil {
+		if redacted, changed := p.redactor.redactAttributes("logs", *attrs); changed {
+			*attrs = redacted
+		}
+	}
+	if body := record.Body(); body != nil {
+		if redacted, changed := p.redactor.redactText("logs", *body, true); changed {
+			*body = redacted
+		}
+	}
+}
+
+func (p *redactingLogProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *redactingLogProcessor) ForceFlush(context.Context) error { return nil }
+
+// ensure the processors satisfy the interfaces of the sdk
+var (
+	_ sdktrace.SpanProcessor     = (*redactingSpanProcessor)(nil)
+	_ sdklogs.LogRecordProcessor = (*redactingLogProcessor)(nil)
+	_ sdktrace.ReadOnlySpan      = (*redactedSpan)(nil)
+)
@@ -0,0 +1,255 @@
+package telemetry_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/telemetry/telemetrytest"
+)
+
+// redactionRules is the rules file used by the tests below, one rule of every action and preset kind
+const redactionRules = `rules:
+  - name: drop-credentials
+    action: drop
+    keys: [http.request.header.authorization]
+  - name: hash-user
+    action: hash
+    keys: [user.*]
+    salt: pepper
+  - name: query-tokens
+    action: mask
+    pattern: '(token=)[^&]*'
+    replacement: '${1}[REDACTED]'
+    keys: [url.full]
+  - name: emails
+    action: mask
+    preset: email
+  - name: card-numbers
+    action: mask
+    preset: credit_card
+`
+
+func writeRules(t *testing.T, rules string) string {
+	path := filepath.Join(t.TempDir(), "redaction-rules.yml")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatalf("failed to write redaction rules: %v", err)
+	}
+	return path
+}
+
+func hashed(value string) string {
+	sum := sha256.Sum256([]byte("pepper" + value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[attribute.Key]string {
+	m := make(map[attribute.Key]string, len(attrs))
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value.Emit()
+	}
+	return m
+}
+
+func checkAttributes(t *testing.T, what string, attrs []attribute.KeyValue, want map[attribute.Key]string) {
+	t.Helper()
+
+	got := attributeMap(attrs)
+	if len(got) != len(want) {
+		t.Errorf("%s has attributes %v, want %v", what, got, want)
+		return
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s has %s = %q, want %q", what, key, got[key], value)
+		}
+	}
+}
+
+func TestRedactSpans(t *testing.T) {
+	rec := telemetrytest.Install(t, telemetry.WithRedactionRulesFile(writeRules(t, redactionRules)))
+	tracer := otel.Tracer("telemetry")
+
+	_, linked := tracer.Start(context.Background(), "linked")
+	linked.End()
+	_, span := tracer.Start(context.Background(), "lookup alice@example.com",
+		trace.WithLinks(trace.Link{
+			SpanContext: linked.SpanContext(),
+			Attributes:  []attribute.KeyValue{attribute.String("user.name", "alice")},
+		}),
+		trace.WithAttributes(
+			attribute.String("http.request.header.authorization", "Bearer secret"),
+			attribute.Int("user.id", 42),
+			attribute.String("url.full", "https://example.com/?token=abc&page=1"),
+			attribute.String("payment.card", "paid with 4111 1111 1111 1111"),
+			attribute.String("request.started", "1718035200123456789"),
+			attribute.Int("http.response.status_code", 200),
+		),
+	)
+	span.AddEvent("sent to bob@example.com", trace.WithAttributes(attribute.String("user.name", "bob")))
+	span.SetStatus(codes.Error, "no account for alice@example.com")
+	span.End()
+
+	got := rec.AssertSpan(t, "lookup [REDACTED]")
+	checkAttributes(t, "span", got.Attributes, map[attribute.Key]string{
+		"user.id":  hashed("42"),
+		"url.full": "https://example.com/?token=[REDACTED]&page=1",
+		// the timestamp has as many digits as a card number, but does not pass the Luhn check
+		"payment.card":              "paid with [REDACTED]",
+		"request.started":           "1718035200123456789",
+		"http.response.status_code": "200",
+	})
+	if got.Status.Description != "no account for [REDACTED]" {
+		t.Errorf("span has status description %q, want %q", got.Status.Description, "no account for [REDACTED]")
+	}
+	if len(got.Events) != 1 || got.Events[0].Name != "sent to [REDACTED]" {
+		t.Fatalf("span has events %v, want a single event named %q", got.Events, "sent to [REDACTED]")
+	}
+	checkAttributes(t, "span event", got.Events[0].Attributes, map[attribute.Key]string{"user.name": hashed("bob")})
+	if len(got.Links) != 1 {
+		t.Fatalf("span has %d links, want 1", len(got.Links))
+	}
+	checkAttributes(t, "span link", got.Links[0].Attributes, map[attribute.Key]string{"user.name": hashed("alice")})
+
+	// a span that no rule applies to is exported as is
+	rec.AssertSpan(t, "linked")
+}
+
+func TestRedactLogs(t *testing.T) {
+	rec := telemetrytest.Install(t, telemetry.WithRedactionRulesFile(writeRules(t, redactionRules)))
+
+	telemetry.Ctx(context.Background()).Info("card 4111-1111-1111-1111 of alice@example.com declined")
+
+	logs := rec.Logs(t)
+	if len(logs) != 1 {
+		t.Fatalf("Logs returned %d records, want 1", len(logs))
+	}
+	if want := "card [REDACTED] of [REDACTED] declined"; logs[0].Body == nil || *logs[0].Body != want {
+		t.Errorf("record has body %v, want %q", logs[0].Body, want)
+	}
+}
+
+func TestRedactionsCounter(t *testing.T) {
+	rec := telemetrytest.Install(t, telemetry.WithRedactionRulesFile(writeRules(t, redactionRules)))
+
+	_, span := otel.Tracer("telemetry").Start(context.Background(), "lookup alice@example.com",
+		trace.WithAttributes(
+			attribute.String("http.request.header.authorization", "Bearer secret"),
+			attribute.String("user.id", "42"),
+			attribute.String("user.name", "alice"),
+		),
+	)
+	span.End()
+	telemetry.Ctx(context.Background()).Info("reply to alice@example.com")
+
+	m, ok := rec.FindMetric(t, "telemetry.redactions")
+	if !ok {
+		t.Fatalf("telemetry.redactions was not reported")
+	}
+	got := map[string]int64{}
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		rule, _ := dp.Attributes.Value("rule")
+		signal, _ := dp.Attributes.Value("signal")
+		got[signal.AsString()+"/"+rule.AsString()] += dp.Value
+	}
+	want := map[string]int64{"traces/drop-credentials": 1, "traces/hash-user": 2, "traces/emails": 1, "logs/emails": 1}
+	if len(got) != len(want) {
+		t.Fatalf("telemetry.redactions counted %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("telemetry.redactions counted %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestRedactionRulesErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			rules:   "rules:\n  - name: a\n    action: drop\n    key: [a]\n",
+			wantErr: "field key not found",
+		},
+		{
+			name:    "missing name",
+			rules:   "rules:\n  - action: drop\n    keys: [a]\n",
+			wantErr: "rules[0]: name is required",
+		},
+		{
+			name:    "duplicate name",
+			rules:   "rules:\n  - name: a\n    action: drop\n    keys: [a]\n  - name: a\n    action: drop\n    keys: [b]\n",
+			wantErr: `rules[1]: duplicate rule name "a"`,
+		},
+		{
+			name:    "unsupported action",
+			rules:   "rules:\n  - name: a\n    action: encrypt\n    keys: [a]\n",
+			wantErr: "rules[0]: unsupported action \"encrypt\", must be one of `drop`, `hash` or `mask`",
+		},
+		{
+			name:    "drop without keys",
+			rules:   "rules:\n  - name: a\n    action: drop\n",
+			wantErr: "rules[0]: a drop rule requires attribute keys",
+		},
+		{
+			name:    "hash of the body",
+			rules:   "rules:\n  - name: a\n    action: hash\n    keys: [user.id, body]\n",
+			wantErr: "rules[0]: a hash rule cannot apply to the log body, only a mask rule can",
+		},
+		{
+			name:    "unknown preset",
+			rules:   "rules:\n  - name: a\n    action: mask\n    preset: iban\n",
+			wantErr: "rules[0]: unknown preset \"iban\", must be one of `bearer_token`, `credit_card`, `email`, `jwt`",
+		},
+		{
+			name:    "invalid pattern",
+			rules:   "rules:\n  - name: a\n    action: mask\n    pattern: '('\n",
+			wantErr: "rules[0]: invalid pattern: error parsing regexp: missing closing ): `(`",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeRules(t, tc.rules)
+			tel, err := telemetry.Init(context.Background(),
+				telemetry.WithServiceName("telemetrytest"),
+				telemetry.WithTracesExporter("memory"),
+				telemetry.WithMetricsExporter("memory"),
+				telemetry.WithLogsExporter("memory"),
+				telemetry.WithAdminPort("0"),
+				telemetry.WithRedactionRulesFile(path),
+			)
+			if err == nil {
+				_ = tel.Shutdown(context.Background())
+				t.Fatalf("Init succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), "invalid REDACTION_RULES_FILE "+path) ||
+				!strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Init returned %q, want an error naming the file and containing %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	_, err := telemetry.Init(context.Background(),
+		telemetry.WithServiceName("telemetrytest"),
+		telemetry.WithTracesExporter("memory"),
+		telemetry.WithRedactionRulesFile(filepath.Join(t.TempDir(), "missing.yml")),
+	)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Init returned %v, want an error for the missing rules file", err)
+	}
+}
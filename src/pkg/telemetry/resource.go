@@ -0,0 +1,125 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// ServiceVersion is reported as `service.version` on all telemetry. it is intended to be set at build time, e.g.
+// go build -ldflags "-X github.com/bengetch/otel-go/src/pkg/telemetry.ServiceVersion=1.2.3"
+var ServiceVersion string
+
+// instanceID identifies this process among replicas of the same service. it is generated once per process, so
+// that the tracer, meter and logger providers report the same `service.instance.id`
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	/*
+		generate a random (version 4) UUID
+	*/
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Printf("telemetry: failed to generate service.instance.id: %v\n", err)
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func resolveServiceVersion(cfg *config) string {
+	/*
+		resolve the service version from, in order of precedence: the WithServiceVersion option, the
+		ServiceVersion variable set through ldflags, and the build info embedded by the go toolchain
+	*/
+
+	if cfg.serviceVersion != "" {
+		return cfg.serviceVersion
+	}
+	if ServiceVersion != "" {
+		return ServiceVersion
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && setting.Value != "" {
+			return setting.Value
+		}
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return ""
+}
+
+func serviceAttributes(cfg *config) []attribute.KeyValue {
+	/*
+		collect the service attributes that are known to this process rather than detected from the host
+	*/
+
+	var attrs []attribute.KeyValue
+	if instanceID != "" {
+		attrs = append(attrs, semconv.ServiceInstanceID(instanceID))
+	}
+	if version := resolveServiceVersion(cfg); version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(version))
+	}
+	if cfg.deploymentEnvironment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.deploymentEnvironment))
+	}
+
+	return attrs
+}
+
+func newResource(ctx context.Context, cfg *config) (*resource.Resource, error) {
+	/*
+		construct the resource shared by the logger, tracer and meter providers, so that all three
+		signals can be correlated by the same attributes. detectors are applied in order, with later
+		ones taking precedence: host, OS, process and container detectors first, then attributes known
+		to this process, then the resource of the configuration file, then OTEL_RESOURCE_ATTRIBUTES.
+		the resolved service name always wins
+	*/
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		// command line arguments are deliberately left out, since they may contain secrets
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessExecutablePath(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithContainer(),
+		resource.WithAttributes(serviceAttributes(cfg)...),
+		resource.WithAttributes(cfg.fileResourceAttributes()...),
+		resource.WithFromEnv(),
+		resource.WithAttributes(semconv.ServiceName(cfg.serviceName)),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		// a detector that fails, e.g. because the process owner cannot be looked up inside a minimal
+		// container, or a malformed entry in OTEL_RESOURCE_ATTRIBUTES should not prevent the service
+		// from starting
+		log.Printf("telemetry: some resource attributes could not be detected: %v\n", err)
+		return res, nil
+	}
+
+	return res, err
+}
@@ -0,0 +1,329 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/procfs"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// names of the samples read from runtime/metrics, see https://pkg.go.dev/runtime/metrics#hdr-Supported_metrics
+const (
+	goTotalMemory       = "/memory/classes/total:bytes"
+	goReleasedMemory    = "/memory/classes/heap/released:bytes"
+	goStackMemory       = "/memory/classes/heap/stacks:bytes"
+	goMemoryLimit       = "/gc/gomemlimit:bytes"
+	goMemoryAllocated   = "/gc/heap/allocs:bytes"
+	goMemoryAllocations = "/gc/heap/allocs:objects"
+	goMemoryGoal        = "/gc/heap/goal:bytes"
+	goGoroutines        = "/sched/goroutines:goroutines"
+	goMaxProcs          = "/sched/gomaxprocs:threads"
+	goConfigGC          = "/gc/gogc:percent"
+	goSchedLatencies    = "/sched/latencies:seconds"
+	goGCPauses          = "/sched/pauses/total/gc:seconds"
+)
+
+// attribute keys defined by the semantic conventions for runtime and process metrics, which are newer than the
+// semconv package used by this module
+const (
+	goMemoryTypeKey = attribute.Key("go.memory.type")
+	cpuModeKey      = attribute.Key("cpu.mode")
+)
+
+// runtimeHistogramsScope is the instrumentation scope of the runtime histograms. it differs from the scope of the
+// meter, since a reader that is handed the same scope by both a meter and a producer reports it twice
+const runtimeHistogramsScope = instrumentationName + "/runtime"
+
+// runtimeHistogramBounds are the bucket boundaries of the runtime histograms, in seconds
+var runtimeHistogramBounds = []float64{0.000001, 0.00001, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 1}
+
+// processStart is the start of the cumulative runtime histograms, which are counted from program start
+var processStart = time.Now()
+
+// runtimeSamples reads a fixed set of samples from runtime/metrics
+type runtimeSamples struct {
+	mu      sync.Mutex
+	samples []metrics.Sample
+	index   map[string]int
+}
+
+func newRuntimeSamples(names ...string) *runtimeSamples {
+	s := &runtimeSamples{samples: make([]metrics.Sample, len(names)), index: make(map[string]int, len(names))}
+	for i, name := range names {
+		s.samples[i].Name = name
+		s.index[name] = i
+	}
+	return s
+}
+
+func (s *runtimeSamples) int64(name string) int64 {
+	/*
+		return the value of an integer sample, or 0 if the runtime does not support it
+	*/
+
+	value := s.samples[s.index[name]].Value
+	if value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(min(value.Uint64(), math.MaxInt64))
+}
+
+func (s *runtimeSamples) histogram(name string) *metrics.Float64Histogram {
+	/*
+		return the value of a histogram sample, or nil if the runtime does not support it
+	*/
+
+	value := s.samples[s.index[name]].Value
+	if value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	return value.Float64Histogram()
+}
+
+func startRuntimeMetrics(mp metric.MeterProvider) error {
+	/*
+		report the memory, goroutines and GC settings of the Go runtime under the names of the semantic
+		conventions for Go runtime metrics, e.g. `go.memory.used` and `go.goroutine.count`. the
+		histograms of scheduling latency and GC pauses are reported by the runtimeProducer instead, out
+		of reach of views
+	*/
+
+	meter := mp.Meter(instrumentationName)
+	samples := newRuntimeSamples(
+		goTotalMemory, goReleasedMemory, goStackMemory, goMemoryLimit, goMemoryAllocated, goMemoryAllocations,
+		goMemoryGoal, goGoroutines, goMaxProcs, goConfigGC,
+	)
+
+	var errs []error
+	upDownCounter := func(name string, description string, unit string) metric.Int64ObservableUpDownCounter {
+		instrument, err := meter.Int64ObservableUpDownCounter(name,
+			metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return instrument
+	}
+	counter := func(name string, description string, unit string) metric.Int64ObservableCounter {
+		instrument, err := meter.Int64ObservableCounter(name, metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return instrument
+	}
+
+	memoryUsed := upDownCounter("go.memory.used", "Memory used by the Go runtime", "By")
+	memoryLimit := upDownCounter("go.memory.limit", "Go runtime memory limit configured by the user, if a limit exists", "By")
+	memoryAllocated := counter("go.memory.allocated", "Memory allocated to the heap by the application", "By")
+	memoryAllocations := counter("go.memory.allocations", "Count of allocations to the heap by the application", "{allocation}")
+	memoryGoal := upDownCounter("go.memory.gc.goal", "Heap size target for the end of the GC cycle", "By")
+	goroutines := upDownCounter("go.goroutine.count", "Count of live goroutines", "{goroutine}")
+	processorLimit := upDownCounter("go.processor.limit",
+		"The number of OS threads that can execute user-level Go code simultaneously", "{thread}")
+	configGC := upDownCounter("go.config.gogc", "Heap size target percentage configured by the user, otherwise 100", "%")
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	stackMemory := metric.WithAttributes(goMemoryTypeKey.String("stack"))
+	otherMemory := metric.WithAttributes(goMemoryTypeKey.String("other"))
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		samples.mu.Lock()
+		defer samples.mu.Unlock()
+		metrics.Read(samples.samples)
+
+		stack := samples.int64(goStackMemory)
+		o.ObserveInt64(memoryUsed, stack, stackMemory)
+		o.ObserveInt64(memoryUsed, samples.int64(goTotalMemory)-samples.int64(goReleasedMemory)-stack, otherMemory)
+		// without a limit, the runtime reports math.MaxInt64
+		if limit := samples.int64(goMemoryLimit); limit != math.MaxInt64 {
+			o.ObserveInt64(memoryLimit, limit)
+		}
+		o.ObserveInt64(memoryAllocated, samples.int64(goMemoryAllocated))
+		o.ObserveInt64(memoryAllocations, samples.int64(goMemoryAllocations))
+		o.ObserveInt64(memoryGoal, samples.int64(goMemoryGoal))
+		o.ObserveInt64(goroutines, samples.int64(goGoroutines))
+		o.ObserveInt64(processorLimit, samples.int64(goMaxProcs))
+		o.ObserveInt64(configGC, samples.int64(goConfigGC))
+		return nil
+	}, memoryUsed, memoryLimit, memoryAllocated, memoryAllocations, memoryGoal, goroutines, processorLimit, configGC)
+	return err
+}
+
+// runtimeProducer reports the histograms kept by the Go runtime, which cannot be recorded through an instrument
+// since they are only available as cumulative bucket counts. every reader needs a producer of its own. the data
+// it produces is handed to the reader as it is, so the views of the meter provider, the temporality preference of
+// the exporter and the exemplar filter do not apply to these histograms
+type runtimeProducer struct {
+	samples *runtimeSamples
+}
+
+func newRuntimeProducer(cfg *config) sdkmetric.Producer {
+	/*
+		construct a producer of the runtime histograms for a reader, or return nil if runtime metrics
+		are disabled
+	*/
+
+	if !*cfg.runtimeMetrics {
+		return nil
+	}
+	return &runtimeProducer{samples: newRuntimeSamples(goSchedLatencies, goGCPauses)}
+}
+
+func (p *runtimeProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	p.samples.mu.Lock()
+	defer p.samples.mu.Unlock()
+	metrics.Read(p.samples.samples)
+	now := time.Now()
+
+	var data []metricdata.Metrics
+	for _, histogram := range []struct {
+		sample      string
+		name        string
+		description string
+	}{
+		{goSchedLatencies, "go.schedule.duration",
+			"The time goroutines have spent in the scheduler in a runnable state before actually running"},
+		// the semantic conventions have no metric for GC pauses yet, so it is named outside of their `go.`
+		// namespace, which a future convention may claim with a different meaning
+		{goGCPauses, "telemetry.runtime.gc.pause.duration",
+			"The time the application was stopped by the garbage collector"},
+	} {
+		dataPoint, ok := convertRuntimeHistogram(p.samples.histogram(histogram.sample), now)
+		if !ok {
+			continue
+		}
+		data = append(data, metricdata.Metrics{
+			Name:        histogram.name,
+			Description: histogram.description,
+			Unit:        "s",
+			Data: metricdata.Histogram[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				DataPoints:  []metricdata.HistogramDataPoint[float64]{dataPoint},
+			},
+		})
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return []metricdata.ScopeMetrics{{Scope: instrumentation.Scope{Name: runtimeHistogramsScope}, Metrics: data}}, nil
+}
+
+func convertRuntimeHistogram(h *metrics.Float64Histogram, now time.Time) (metricdata.HistogramDataPoint[float64], bool) {
+	/*
+		convert a runtime histogram into an explicit bucket histogram data point with the boundaries of
+		runtimeHistogramBounds. the runtime keeps well over a hundred buckets per histogram, so every
+		runtime bucket is counted into the first boundary at or above its upper bound. the sum is not
+		tracked by the runtime, so it is estimated from the lower bound of every bucket
+	*/
+
+	if h == nil || len(h.Buckets) < 2 {
+		return metricdata.HistogramDataPoint[float64]{}, false
+	}
+
+	counts := make([]uint64, len(runtimeHistogramBounds)+1)
+	var count uint64
+	var sum float64
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		upper := h.Buckets[i+1]
+		bucket, _ := slices.BinarySearch(runtimeHistogramBounds, upper)
+		counts[bucket] += c
+		count += c
+		if lower := h.Buckets[i]; !math.IsInf(lower, 0) {
+			sum += lower * float64(c)
+		}
+	}
+
+	return metricdata.HistogramDataPoint[float64]{
+		StartTime:    processStart,
+		Time:         now,
+		Count:        count,
+		Sum:          sum,
+		Bounds:       slices.Clone(runtimeHistogramBounds),
+		BucketCounts: counts,
+	}, true
+}
+
+func startProcessMetrics(mp metric.MeterProvider) error {
+	/*
+		report the CPU time, memory and open file descriptors of this process under the names of the
+		semantic conventions for process metrics. they are read from /proc, so on platforms without it
+		they are left out
+	*/
+
+	proc, err := procfs.Self()
+	if err == nil {
+		_, err = proc.Stat()
+	}
+	if err != nil {
+		log.Printf("telemetry: process metrics are not supported on this platform: %v\n", err)
+		return nil
+	}
+
+	meter := mp.Meter(instrumentationName)
+	var errs []error
+	upDownCounter := func(name string, description string, unit string) metric.Int64ObservableUpDownCounter {
+		instrument, err := meter.Int64ObservableUpDownCounter(name,
+			metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return instrument
+	}
+
+	cpuTime, err := meter.Float64ObservableCounter("process.cpu.time",
+		metric.WithDescription("Total CPU seconds broken down by different CPU modes"), metric.WithUnit("s"))
+	errs = append(errs, err)
+	uptime, err := meter.Float64ObservableGauge("process.uptime",
+		metric.WithDescription("The time the process has been running"), metric.WithUnit("s"))
+	errs = append(errs, err)
+	memoryUsage := upDownCounter("process.memory.usage", "The amount of physical memory in use", "By")
+	memoryVirtual := upDownCounter("process.memory.virtual", "The amount of committed virtual memory", "By")
+	fileDescriptors := upDownCounter("process.unix.file_descriptor.count",
+		"Number of unix file descriptors in use by the process", "{file_descriptor}")
+	threads := upDownCounter("process.thread.count", "Process threads count", "{thread}")
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// procfs reports CPU time in clock ticks of the kernel, which are 100 per second on linux
+	const ticksPerSecond = 100
+	userMode := metric.WithAttributes(cpuModeKey.String("user"))
+	systemMode := metric.WithAttributes(cpuModeKey.String("system"))
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stat, err := proc.Stat()
+		if err != nil {
+			return err
+		}
+		o.ObserveFloat64(cpuTime, float64(stat.UTime)/ticksPerSecond, userMode)
+		o.ObserveFloat64(cpuTime, float64(stat.STime)/ticksPerSecond, systemMode)
+		if start, err := stat.StartTime(); err == nil {
+			o.ObserveFloat64(uptime, time.Since(time.Unix(0, int64(start*float64(time.Second)))).Seconds())
+		}
+		o.ObserveInt64(memoryUsage, int64(stat.ResidentMemory()))
+		o.ObserveInt64(memoryVirtual, int64(stat.VirtualMemory()))
+		o.ObserveInt64(threads, int64(stat.NumThreads))
+
+		fds, err := proc.FileDescriptorsLen()
+		if err != nil {
+			return err
+		}
+		o.ObserveInt64(fileDescriptors, int64(fds))
+		return nil
+	}, cpuTime, uptime, memoryUsage, memoryVirtual, fileDescriptors, threads)
+	return err
+}
+
+// ensure runtimeProducer can be registered with a reader
+var _ sdkmetric.Producer = (*runtimeProducer)(nil)
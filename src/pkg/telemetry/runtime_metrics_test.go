@@ -0,0 +1,31 @@
+package telemetry_test
+
+import (
+	"runtime"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry/telemetrytest"
+)
+
+func TestRuntimeHistograms(t *testing.T) {
+	rec := telemetrytest.Install(t)
+	runtime.GC()
+
+	for _, name := range []string{"go.schedule.duration", "telemetry.runtime.gc.pause.duration"} {
+		m, ok := rec.FindMetric(t, name)
+		if !ok {
+			t.Errorf("%s was not reported", name)
+			continue
+		}
+		histogram, ok := m.Data.(metricdata.Histogram[float64])
+		if !ok || len(histogram.DataPoints) != 1 {
+			t.Errorf("%s has data %#v, want a single float64 histogram data point", name, m.Data)
+			continue
+		}
+		if histogram.DataPoints[0].Count == 0 {
+			t.Errorf("%s has no observations", name)
+		}
+	}
+}
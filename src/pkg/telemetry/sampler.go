@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// sampler names defined by the OpenTelemetry SDK environment variable specification
+const (
+	samplerAlwaysOn                = "always_on"
+	samplerAlwaysOff               = "always_off"
+	samplerTraceIDRatio            = "traceidratio"
+	samplerParentBasedAlwaysOn     = "parentbased_always_on"
+	samplerParentBasedAlwaysOff    = "parentbased_always_off"
+	samplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+// attribute keys added to every sampled span when sampler debugging is enabled
+const (
+	samplerDescriptionKey = attribute.Key("sampler.description")
+	samplerDecisionKey    = attribute.Key("sampler.decision")
+	samplerRouteKey       = attribute.Key("sampler.route")
+)
+
+func parseSamplerRatio(arg string) float64 {
+	/*
+		parse OTEL_TRACES_SAMPLER_ARG as a ratio in [0, 1]. an empty or invalid value falls back to 1.0,
+		i.e. every trace is sampled
+	*/
+
+	if arg == "" {
+		return 1.0
+	}
+
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		log.Printf("telemetry: invalid sampler ratio %q, must be a number between 0 and 1. using 1.0\n", arg)
+		return 1.0
+	}
+
+	return ratio
+}
+
+func parseRouteRatios(value string) map[string]float64 {
+	/*
+		parse a comma separated list of `route=ratio` pairs, e.g. `/=0.01,/chainedAsyncA=1`. entries
+		that cannot be parsed are logged and skipped
+	*/
+
+	routes := make(map[string]float64)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			log.Printf("telemetry: ignoring route sampler entry %q, expected `route=ratio`\n", entry)
+			continue
+		}
+		routes[strings.TrimSpace(entry[:i])] = parseSamplerRatio(entry[i+1:])
+	}
+
+	return routes
+}
+
+// routeSampler samples spans for specific HTTP routes at their own ratio, and delegates all other spans to a
+// fallback sampler. the route is taken from the `http.route` attribute set by otelgin when a server span starts
+type routeSampler struct {
+	routes   map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+	debug    bool
+}
+
+func newRouteSampler(routeRatios map[string]float64, fallback sdktrace.Sampler, debug bool) sdktrace.Sampler {
+	/*
+		construct a routeSampler from a map of route to sampling ratio. if no routes are configured the
+		fallback sampler is returned unchanged
+	*/
+
+	if len(routeRatios) == 0 {
+		return fallback
+	}
+
+	routes := make(map[string]sdktrace.Sampler, len(routeRatios))
+	for route, ratio := range routeRatios {
+		routes[route] = sdktrace.TraceIDRatioBased(ratio)
+	}
+
+	return &routeSampler{routes: routes, fallback: fallback, debug: debug}
+}
+
+func (s *routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key != semconv.HTTPRouteKey {
+			continue
+		}
+		if sampler, ok := s.routes[attr.Value.AsString()]; ok {
+			result := sampler.ShouldSample(p)
+			if s.debug {
+				result.Attributes = append(result.Attributes, samplerRouteKey.String(attr.Value.AsString()))
+			}
+			return result
+		}
+		break
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *routeSampler) Description() string {
+	routes := make([]string, 0, len(s.routes))
+	for route, sampler := range s.routes {
+		routes = append(routes, fmt.Sprintf("%s:%s", route, sampler.Description()))
+	}
+	sort.Strings(routes)
+
+	return fmt.Sprintf("RouteBased{routes:[%s],fallback:%s}", strings.Join(routes, ","), s.fallback.Description())
+}
+
+// debugSampler records the decision made by the wrapped sampler as attributes on the span
+type debugSampler struct {
+	sampler sdktrace.Sampler
+}
+
+func (s *debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.sampler.ShouldSample(p)
+
+	var decision string
+	switch result.Decision {
+	case sdktrace.RecordAndSample:
+		decision = "record_and_sample"
+	case sdktrace.RecordOnly:
+		decision = "record_only"
+	default:
+		decision = "drop"
+	}
+
+	result.Attributes = append(result.Attributes,
+		samplerDescriptionKey.String(s.sampler.Description()),
+		samplerDecisionKey.String(decision),
+	)
+
+	return result
+}
+
+func (s *debugSampler) Description() string {
+	return s.sampler.Description()
+}
+
+func newSampler(cfg *config) sdktrace.Sampler {
+	/*
+		construct the sampler indicated by cfg.sampler and cfg.samplerArg, following the values defined
+		for OTEL_TRACES_SAMPLER. per-route ratios replace the root sampling decision for matching spans,
+		so for the parentbased_* samplers a sampled parent is still always respected
+	*/
+
+	ratio := parseSamplerRatio(cfg.samplerArg)
+
+	var root sdktrace.Sampler
+	parentBased := true
+	switch cfg.sampler {
+	case samplerAlwaysOn:
+		root, parentBased = sdktrace.AlwaysSample(), false
+	case samplerAlwaysOff:
+		root, parentBased = sdktrace.NeverSample(), false
+	case samplerTraceIDRatio:
+		root, parentBased = sdktrace.TraceIDRatioBased(ratio), false
+	case samplerParentBasedAlwaysOff:
+		root = sdktrace.NeverSample()
+	case samplerParentBasedTraceIDRatio:
+		root = sdktrace.TraceIDRatioBased(ratio)
+	case samplerParentBasedAlwaysOn, "":
+		root = sdktrace.AlwaysSample()
+	default:
+		log.Printf("telemetry: unsupported sampler %q, using %s\n", cfg.sampler, samplerParentBasedAlwaysOn)
+		root = sdktrace.AlwaysSample()
+	}
+
+	sampler := newRouteSampler(cfg.routeRatios, root, cfg.samplerDebug)
+	if parentBased {
+		sampler = sdktrace.ParentBased(sampler)
+	}
+	if cfg.samplerDebug {
+		sampler = &debugSampler{sampler: sampler}
+	}
+
+	return sampler
+}
+
+// ensure the wrapping samplers satisfy the sdk interface
+var (
+	_ sdktrace.Sampler = (*routeSampler)(nil)
+	_ sdktrace.Sampler = (*debugSampler)(nil)
+)
@@ -0,0 +1,86 @@
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/telemetry/telemetrytest"
+)
+
+func TestRouteSampler(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		t.Run(fmt.Sprintf("debug=%t", debug), func(t *testing.T) {
+			// routes without a ratio of their own fall back to a root sampler that drops every trace
+			rec := telemetrytest.Install(t,
+				telemetry.WithTracesSampler("parentbased_always_off", ""),
+				telemetry.WithRouteSamplingRatios(map[string]float64{"/always": 1, "/never": 0}),
+				telemetry.WithSamplerDebug(debug),
+			)
+			tracer := otel.Tracer("telemetry")
+
+			start := func(ctx context.Context, name string, route string) (context.Context, trace.Span) {
+				var opts []trace.SpanStartOption
+				if route != "" {
+					opts = append(opts, trace.WithAttributes(semconv.HTTPRoute(route)))
+				}
+				return tracer.Start(ctx, name, opts...)
+			}
+
+			for _, tc := range []struct {
+				name  string
+				route string
+				want  bool
+			}{
+				{name: "always", route: "/always", want: true},
+				{name: "never", route: "/never", want: false},
+				{name: "unmatched", route: "/other", want: false},
+				{name: "no route", want: false},
+			} {
+				ctx, root := start(context.Background(), tc.name, tc.route)
+				// children follow the decision of their parent, whatever their own route
+				_, matching := start(ctx, tc.name+" child", "/always")
+				_, other := start(ctx, tc.name+" other child", "/never")
+				for _, span := range []trace.Span{root, matching, other} {
+					if got := span.SpanContext().IsSampled(); got != tc.want {
+						t.Errorf("span of %s root has sampled = %t, want %t", tc.name, got, tc.want)
+					}
+					span.End()
+				}
+			}
+
+			spans := rec.Spans(t)
+			if len(spans) != 3 {
+				t.Fatalf("Spans returned %d spans, want the 3 spans of the /always trace", len(spans))
+			}
+			debugKeys := []attribute.Key{"sampler.description", "sampler.decision", "sampler.route"}
+			for _, span := range spans {
+				found := map[attribute.Key]string{}
+				for _, attr := range span.Attributes {
+					found[attr.Key] = attr.Value.Emit()
+				}
+				for _, key := range debugKeys {
+					_, ok := found[key]
+					// the route is only recorded by the route sampler, which only decides for the root
+					want := debug && (key != "sampler.route" || span.Name == "always")
+					if ok != want {
+						t.Errorf("span %s has %s = %t, want %t", span.Name, key, ok, want)
+					}
+				}
+				if debug && found["sampler.decision"] != "record_and_sample" {
+					t.Errorf("span %s has sampler.decision %q, want %q",
+						span.Name, found["sampler.decision"], "record_and_sample")
+				}
+				if debug && span.Name == "always" && found["sampler.route"] != "/always" {
+					t.Errorf("span %s has sampler.route %q, want %q", span.Name, found["sampler.route"], "/always")
+				}
+			}
+		})
+	}
+}
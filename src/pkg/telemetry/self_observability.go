@@ -0,0 +1,519 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdklogs "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+	"github.com/go-logr/logr"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"google.golang.org/grpc/status"
+)
+
+// instrumentationName is the name of the meter used for metrics about the telemetry pipeline itself
+const instrumentationName = "github.com/bengetch/otel-go/src/pkg/telemetry"
+
+// attribute keys defined by the semantic conventions for OTel SDK metrics, which are newer than the semconv
+// package used by this module
+const (
+	componentTypeKey  = attribute.Key("otel.component.type")
+	componentNameKey  = attribute.Key("otel.component.name")
+	errorTypeKey      = attribute.Key("error.type")
+	samplingResultKey = attribute.Key("otel.span.sampling_result")
+	parentOriginKey   = attribute.Key("otel.span.parent.origin")
+)
+
+// signalKinds maps each signal to the name the semantic conventions use for a single item of it
+var signalKinds = map[string]string{"traces": "span", "logs": "log", "metrics": "metric"}
+
+// verbosity of the messages logged by the SDK through its internal logger, per OTEL_LOG_LEVEL
+var internalLogVerbosity = map[string]int{
+	"error": 0,
+	"warn":  1,
+	"info":  4,
+	"debug": 8,
+}
+
+func setInternalLogging(cfg *config) {
+	/*
+		route errors reported by the SDK and exporters, as well as the messages of the internal logger of
+		the SDK, to stderr. OTEL_LOG_LEVEL (`error`, `warn`, `info` or `debug`, default `info`) controls
+		which internal messages are logged, while errors are always logged. neither goes through the
+		global zap logger, which writes into the logs pipeline: a failing log export would then report
+		itself through the pipeline that is failing, without end
+	*/
+
+	verbosity, ok := internalLogVerbosity[cfg.logLevel]
+	if !ok {
+		if cfg.logLevel != "" {
+			log.Printf("telemetry: unsupported OTEL_LOG_LEVEL %q, using `info`\n", cfg.logLevel)
+		}
+		verbosity = internalLogVerbosity["info"]
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewConsoleEncoder(encoderConfig),
+		zapcore.Lock(os.Stderr),
+		zapcore.DebugLevel,
+	)).Named("otel")
+	otel.SetLogger(logr.New(&zapLogSink{logger: logger, verbosity: verbosity}))
+	otel.SetErrorHandler(internalErrorHandler(logger))
+}
+
+func internalErrorHandler(logger *zap.Logger) otel.ErrorHandler {
+	/*
+		log the errors reported by the SDK through the same stderr logger as its internal messages, so that
+		both come out in one format
+	*/
+
+	return otel.ErrorHandlerFunc(func(err error) {
+		logger.Error("pipeline error", zap.Error(err))
+	})
+}
+
+// zapLogSink implements logr.LogSink on top of a zap logger that writes to stderr. the SDK logs warnings at
+// verbosity 1, informational messages at 4 and debug messages at 8
+type zapLogSink struct {
+	logger    *zap.Logger
+	verbosity int
+	fields    []zap.Field
+}
+
+func (s *zapLogSink) Init(logr.RuntimeInfo) {}
+
+func (s *zapLogSink) Enabled(level int) bool {
+	return level <= s.verbosity
+}
+
+func (s *zapLogSink) Info(level int, msg string, keysAndValues ...any) {
+	zapLevel := zapcore.WarnLevel
+	switch {
+	case level >= internalLogVerbosity["debug"]:
+		zapLevel = zapcore.DebugLevel
+	case level >= internalLogVerbosity["info"]:
+		zapLevel = zapcore.InfoLevel
+	}
+	s.logger.Log(zapLevel, msg, s.withFields(keysAndValues)...)
+}
+
+func (s *zapLogSink) Error(err error, msg string, keysAndValues ...any) {
+	s.logger.Error(msg, append(s.withFields(keysAndValues), zap.Error(err))...)
+}
+
+func (s *zapLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &zapLogSink{logger: s.logger, verbosity: s.verbosity, fields: s.withFields(keysAndValues)}
+}
+
+func (s *zapLogSink) WithName(name string) logr.LogSink {
+	return &zapLogSink{logger: s.logger.Named(name), verbosity: s.verbosity, fields: s.fields}
+}
+
+func (s *zapLogSink) withFields(keysAndValues []any) []zap.Field {
+	fields := slices.Clip(s.fields)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value any
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fields = append(fields, zap.Any(fmt.Sprint(keysAndValues[i]), value))
+	}
+	return fields
+}
+
+// exportError is returned by the exporter wrappers of every signal, and names the exporter that failed
+type exportError struct {
+	signal   string
+	exporter string
+	err      error
+}
+
+func (e *exportError) Error() string {
+	return fmt.Sprintf("%s exporter %s: %v", e.signal, e.exporter, e.err)
+}
+
+func (e *exportError) Unwrap() error {
+	return e.err
+}
+
+func exportErrorType(err error) string {
+	/*
+		classify an export error for the `error.type` attribute, using the grpc status code where there is
+		one. the OTLP exporters do not expose HTTP status codes, so other failures are reported as `_OTHER`
+	*/
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code().String()
+	}
+	return "_OTHER"
+}
+
+// pipelineMetrics records metrics about the telemetry pipeline itself, following the semantic conventions for
+// OTel SDK metrics. the instruments can only be created once the meter provider exists, after the logger and
+// tracer providers, so anything that happens before then is not counted
+type pipelineMetrics struct {
+	instruments atomic.Pointer[pipelineInstruments]
+
+	mu         sync.Mutex
+	components map[string]int
+}
+
+type pipelineInstruments struct {
+	spansStarted   metric.Int64Counter
+	spansEnded     metric.Int64Counter
+	exportDuration metric.Float64Histogram
+	// exported holds the counter of exported items for every signal
+	exported map[string]metric.Int64Counter
+	// processed holds the counter of items handed to batch processors for the traces and logs signals
+	processed map[string]metric.Int64Counter
+}
+
+func newPipelineMetrics() *pipelineMetrics {
+	return &pipelineMetrics{components: make(map[string]int)}
+}
+
+func (m *pipelineMetrics) start(mp metric.MeterProvider) error {
+	/*
+		create the instruments on `mp`, after which the components of the pipeline start recording
+	*/
+
+	meter := mp.Meter(instrumentationName)
+	instruments := &pipelineInstruments{
+		exported:  make(map[string]metric.Int64Counter),
+		processed: make(map[string]metric.Int64Counter),
+	}
+
+	var err error
+	if instruments.spansStarted, err = meter.Int64Counter("otel.sdk.span.started",
+		metric.WithDescription("The number of created spans that are recorded"),
+		metric.WithUnit("{span}"),
+	); err != nil {
+		return err
+	}
+	if instruments.spansEnded, err = meter.Int64Counter("otel.sdk.span.ended",
+		metric.WithDescription("The number of recorded spans that have ended"),
+		metric.WithUnit("{span}"),
+	); err != nil {
+		return err
+	}
+	if instruments.exportDuration, err = meter.Float64Histogram("otel.sdk.exporter.operation.duration",
+		metric.WithDescription("The duration of exporting a batch of telemetry"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	); err != nil {
+		return err
+	}
+
+	for _, signal := range []struct {
+		name        string
+		metric      string
+		description string
+		unit        string
+	}{
+		{"traces", "otel.sdk.exporter.span.exported", "The number of spans for which export was attempted", "{span}"},
+		{"logs", "otel.sdk.exporter.log.exported", "The number of log records for which export was attempted", "{log_record}"},
+		{"metrics", "otel.sdk.exporter.metric_data_point.exported", "The number of metric data points for which export was attempted", "{data_point}"},
+	} {
+		if instruments.exported[signal.name], err = meter.Int64Counter(signal.metric,
+			metric.WithDescription(signal.description+", with `error.type` set on failed exports"),
+			metric.WithUnit(signal.unit),
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, signal := range []struct {
+		name   string
+		metric string
+		unit   string
+	}{
+		{"traces", "otel.sdk.processor.span.processed", "{span}"},
+		{"logs", "otel.sdk.processor.log.processed", "{log_record}"},
+	} {
+		if instruments.processed[signal.name], err = meter.Int64Counter(signal.metric,
+			metric.WithDescription("The number of items handed to batch processors, with `error.type` set on those "+
+				"dropped because the queue was full"),
+			metric.WithUnit(signal.unit),
+		); err != nil {
+			return err
+		}
+	}
+
+	m.instruments.Store(instruments)
+	return nil
+}
+
+func (m *pipelineMetrics) componentName(componentType string) string {
+	/*
+		name a component of the pipeline after its type and the number of components of that type
+		created before it, per the semantic conventions
+	*/
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := fmt.Sprintf("%s/%d", componentType, m.components[componentType])
+	m.components[componentType]++
+	return name
+}
+
+func exporterComponentType(signal string, exporterType string) string {
+	/*
+		return the `otel.component.type` of an exporter, e.g. `otlp_grpc_span_exporter`. the semantic
+		conventions only define types for OTLP exporters, the others follow the same pattern
+	*/
+
+	kind := signalKinds[signal]
+
+	switch exporterType {
+	case exporterOTLP, exporterOTLPHTTP:
+		if otlpProtocol(signal, exporterType) == protocolHTTPProtobuf {
+			return "otlp_http_" + kind + "_exporter"
+		}
+		return "otlp_grpc_" + kind + "_exporter"
+	case exporterStdout:
+		return "console_" + kind + "_exporter"
+	default:
+		return exporterType + "_" + kind + "_exporter"
+	}
+}
+
+// exportObserver records the duration and outcome of the exports of a single exporter
+type exportObserver struct {
+	metrics *pipelineMetrics
+	signal  string
+	attrs   []attribute.KeyValue
+}
+
+func (m *pipelineMetrics) newExportObserver(signal string, exporterType string) *exportObserver {
+	componentType := exporterComponentType(signal, exporterType)
+	return &exportObserver{
+		metrics: m,
+		signal:  signal,
+		attrs: []attribute.KeyValue{
+			componentTypeKey.String(componentType),
+			componentNameKey.String(m.componentName(componentType)),
+		},
+	}
+}
+
+func (o *exportObserver) record(ctx context.Context, start time.Time, items int, err error) {
+	instruments := o.metrics.instruments.Load()
+	if instruments == nil {
+		return
+	}
+
+	attrs := o.attrs
+	if err != nil {
+		attrs = append(slices.Clip(attrs), errorTypeKey.String(exportErrorType(err)))
+	}
+	opt := metric.WithAttributes(attrs...)
+
+	instruments.exportDuration.Record(ctx, time.Since(start).Seconds(), opt)
+	instruments.exported[o.signal].Add(ctx, int64(items), opt)
+}
+
+// queueBound limits the number of items waiting in a batch processor, and counts those it accepts and those it
+// turns away. the batch processors of the SDKs drop items silently once their queue is full, so they run in
+// blocking mode behind a queueBound instead, which keeps their queue from ever filling up. an item counts as waiting
+// from the moment it is accepted until the exporter receives the batch it is part of
+type queueBound struct {
+	metrics *pipelineMetrics
+	signal  string
+	maxSize int64
+	pending atomic.Int64
+	attrs   []attribute.KeyValue
+}
+
+func (m *pipelineMetrics) newQueueBound(signal string, maxSize int) *queueBound {
+	componentType := "batching_" + signalKinds[signal] + "_processor"
+	return &queueBound{
+		metrics: m,
+		signal:  signal,
+		maxSize: int64(maxSize),
+		attrs: []attribute.KeyValue{
+			componentTypeKey.String(componentType),
+			componentNameKey.String(m.componentName(componentType)),
+		},
+	}
+}
+
+func (b *queueBound) admit() bool {
+	/*
+		accept an item into the queue, unless it is full
+	*/
+
+	admitted := b.pending.Add(1) <= b.maxSize
+	if !admitted {
+		b.pending.Add(-1)
+	}
+
+	if instruments := b.metrics.instruments.Load(); instruments != nil {
+		attrs := b.attrs
+		if !admitted {
+			attrs = append(slices.Clip(attrs), errorTypeKey.String("queue_full"))
+		}
+		instruments.processed[b.signal].Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	}
+	return admitted
+}
+
+func (b *queueBound) release(items int) {
+	/*
+		remove the items of a batch that reached the exporter from the queue. a nil bound, that of an
+		exporter behind a simple processor, does nothing
+	*/
+
+	if b != nil {
+		b.pending.Add(-int64(items))
+	}
+}
+
+func maxQueueSize(envName string, ps *processorSettings, defaultSize int) int {
+	/*
+		return the queue size of a batch processor as the SDK resolves it: from `envName`, then from the
+		configuration file, then the default of the SDK
+	*/
+
+	if value, err := strconv.Atoi(os.Getenv(envName)); err == nil && value > 0 {
+		return value
+	}
+	if ps != nil && ps.maxQueueSize > 0 {
+		return ps.maxQueueSize
+	}
+	return defaultSize
+}
+
+// boundedSpanProcessor hands the spans that fit in its queueBound to a batch span processor
+type boundedSpanProcessor struct {
+	sdktrace.SpanProcessor
+	bound *queueBound
+}
+
+func (p *boundedSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// the batch processor discards spans that are not sampled without queueing them
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if p.bound.admit() {
+		p.SpanProcessor.OnEnd(s)
+	}
+}
+
+// boundedLogRecordProcessor hands the log records that fit in its queueBound to a batch log record processor
+type boundedLogRecordProcessor struct {
+	sdklogs.LogRecordProcessor
+	bound *queueBound
+}
+
+func (p *boundedLogRecordProcessor) OnEmit(record sdklogs.ReadableLogRecord) {
+	if p.bound.admit() {
+		p.LogRecordProcessor.OnEmit(record)
+	}
+}
+
+// spanCountProcessor counts the spans that are started and ended
+type spanCountProcessor struct {
+	metrics *pipelineMetrics
+}
+
+func (p *spanCountProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	instruments := p.metrics.instruments.Load()
+	if instruments == nil {
+		return
+	}
+
+	origin := "none"
+	if parentSpan := trace.SpanContextFromContext(parent); parentSpan.IsValid() {
+		origin = "local"
+		if parentSpan.IsRemote() {
+			origin = "remote"
+		}
+	}
+	instruments.spansStarted.Add(parent, 1, metric.WithAttributes(
+		parentOriginKey.String(origin),
+		samplingResultKey.String(samplingResult(s.SpanContext())),
+	))
+}
+
+func (p *spanCountProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	instruments := p.metrics.instruments.Load()
+	if instruments == nil {
+		return
+	}
+
+	instruments.spansEnded.Add(context.Background(), 1, metric.WithAttributes(
+		samplingResultKey.String(samplingResult(s.SpanContext())),
+	))
+}
+
+func (p *spanCountProcessor) Shutdown(ctx context.Context) error { return nil }
+
+func (p *spanCountProcessor) ForceFlush(ctx context.Context) error { return nil }
+
+func samplingResult(sc trace.SpanContext) string {
+	/*
+		spans that are not recorded never reach a span processor, so only two of the three sampling
+		results can be observed
+	*/
+
+	if sc.IsSampled() {
+		return "RECORD_AND_SAMPLE"
+	}
+	return "RECORD_ONLY"
+}
+
+func countDataPoints(rm *metricdata.ResourceMetrics) int {
+	/*
+		count the data points in `rm`, the unit in which exported metrics are counted
+	*/
+
+	count := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				count += len(data.DataPoints)
+			case metricdata.Gauge[float64]:
+				count += len(data.DataPoints)
+			case metricdata.Sum[int64]:
+				count += len(data.DataPoints)
+			case metricdata.Sum[float64]:
+				count += len(data.DataPoints)
+			case metricdata.Histogram[int64]:
+				count += len(data.DataPoints)
+			case metricdata.Histogram[float64]:
+				count += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[int64]:
+				count += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[float64]:
+				count += len(data.DataPoints)
+			case metricdata.Summary:
+				count += len(data.DataPoints)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,218 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/agoda-com/opentelemetry-go/otelzap"
+	sdklogs "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Telemetry holds the logger, tracer and meter providers configured by Init. the providers are nil
+// when the SDK is disabled through OTEL_SDK_DISABLED
+type Telemetry struct {
+	LoggerProvider *sdklogs.LoggerProvider
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	Resource       *resource.Resource
+	// Propagator combines the propagators selected through OTEL_PROPAGATORS, and is registered globally as well.
+	// it is set even when the SDK is disabled
+	Propagator propagation.TextMapPropagator
+	// Memory is set when at least one signal uses the `memory` exporter
+	Memory *Memory
+
+	admin *adminServer
+	// restoreEnv restores the exemplar variables Init set in the environment
+	restoreEnv func() error
+}
+
+// signalProcessors are registered with the tracer and logger providers ahead of the processors that export
+// spans and log records, so that the attributes they add are exported as well
+type signalProcessors struct {
+	spans []sdktrace.SpanProcessor
+	logs  []sdklogs.LogRecordProcessor
+	// redactor redacts spans on their way to the processors that export them, nil when there are no rules
+	redactor *redactor
+}
+
+func newSignalProcessors(cfg *config) (*signalProcessors, error) {
+	/*
+		construct the processors that enrich and redact spans and log records. baggage is copied first,
+		so that redaction rules apply to it as well
+	*/
+
+	p := &signalProcessors{}
+	if baggage := newBaggageSpanProcessor(cfg); baggage != nil {
+		p.spans = append(p.spans, baggage)
+	}
+
+	var err error
+	if p.redactor, err = newRedactor(cfg); err != nil {
+		return nil, err
+	}
+	if p.redactor != nil {
+		p.logs = append(p.logs, &redactingLogProcessor{redactor: p.redactor})
+	}
+
+	return p, nil
+}
+
+func (p *signalProcessors) exportingSpans(processors []sdktrace.SpanProcessor) []sdktrace.SpanProcessor {
+	/*
+		route the spans for `processors`, which export them, through the redactor, if any
+	*/
+
+	if p.redactor == nil || len(processors) == 0 {
+		return processors
+	}
+	return []sdktrace.SpanProcessor{&redactingSpanProcessor{redactor: p.redactor, next: processors}}
+}
+
+func Init(ctx context.Context, opts ...Option) (*Telemetry, error) {
+	/*
+		configure logger, tracer and meter providers and register them globally. values not passed as
+		options are read from the standard OTEL_* environment variables. the logger provider backs the
+		global zap logger, so that logs written via otelzap carry trace context where applicable, and
+		errors and internal messages of the SDK are logged through it as well. the text map propagator
+		configured here ensures that trace context is propagated correctly across API calls
+	*/
+
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize telemetry: %w", err)
+	}
+	if cfg.serviceName == "" {
+		return nil, errors.New("failed to initialize telemetry: service name is empty, set OTEL_SERVICE_NAME")
+	}
+
+	t := &Telemetry{Propagator: propagation.NewCompositeTextMapPropagator(cfg.propagators...)}
+	otel.SetTextMapPropagator(t.Propagator)
+
+	if cfg.disabled {
+		// leave the global no-op providers in place. trace context is still propagated, so that
+		// services downstream of this one can continue the trace
+		log.Printf("telemetry: OTEL_SDK_DISABLED is set, no telemetry will be recorded\n")
+		return t, nil
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct resource: %w", err)
+	}
+	t.Resource = res
+	t.Memory = newMemory(cfg)
+	t.admin = newAdminServer(cfg)
+
+	pipeline := newPipelineMetrics()
+	controls := newRuntimeControls(cfg, res)
+	registerAdminAPI(t.admin, cfg.adminToken, controls)
+	processors, err := newSignalProcessors(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure telemetry processors: %w", err)
+	}
+
+	lp, err := newLoggerProvider(ctx, cfg, res, t.Memory, pipeline, controls, processors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log provider: %w", err)
+	}
+	t.LoggerProvider = lp
+	// the level of the core is raised to info by the leveledCore, unless changed through the admin API
+	core := otelzap.NewOtelCore(lp, otelzap.WithLevel(zapcore.DebugLevel))
+	zap.ReplaceGlobals(zap.New(&leveledCore{Core: core, level: controls.logLevel}))
+	logBaggage.Store(cfg.baggage)
+	setInternalLogging(cfg)
+
+	tp, err := newTracerProvider(ctx, cfg, res, t.Memory, pipeline, controls, processors)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to get tracer provider: %w", err), t.Shutdown(ctx))
+	}
+	t.TracerProvider = tp
+	otel.SetTracerProvider(tp)
+
+	if cfg.exemplarFilter, t.restoreEnv, err = enableExemplars(cfg.exemplarFilter, *cfg.exemplarEnv); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to enable exemplars: %w", err), t.Shutdown(ctx))
+	}
+	mp, err := newMeterProvider(ctx, cfg, res, t.Memory, t.admin, pipeline, controls)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to get meter provider: %w", err), t.Shutdown(ctx))
+	}
+	t.MeterProvider = mp
+	otel.SetMeterProvider(mp)
+
+	if err := pipeline.start(mp); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to record telemetry pipeline metrics: %w", err), t.Shutdown(ctx))
+	}
+	if processors.redactor != nil {
+		if err := processors.redactor.start(mp); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to record redaction metrics: %w", err), t.Shutdown(ctx))
+		}
+	}
+
+	if *cfg.runtimeMetrics {
+		if err := startRuntimeMetrics(mp); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to record runtime metrics: %w", err), t.Shutdown(ctx))
+		}
+	}
+	if *cfg.processMetrics {
+		if err := startProcessMetrics(mp); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to record process metrics: %w", err), t.Shutdown(ctx))
+		}
+	}
+
+	if err := t.admin.Start(); err != nil {
+		return nil, errors.Join(err, t.Shutdown(ctx))
+	}
+
+	return t, nil
+}
+
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	/*
+		call shutdown function on all telemetry provider types, flushing anything still buffered in their
+		processors and readers, and return every error encountered. the logger provider is shut down last,
+		so that anything logged while the tracer and meter providers flush is still exported
+	*/
+
+	var errs []error
+
+	if err := t.admin.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("error while shutting down admin server: %w", err))
+	}
+
+	if t.TracerProvider != nil {
+		if err := t.TracerProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error while shutting down tracer provider: %w", err))
+		}
+	}
+
+	if t.MeterProvider != nil {
+		if err := t.MeterProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error while shutting down meter provider: %w", err))
+		}
+	}
+
+	if t.LoggerProvider != nil {
+		if err := t.LoggerProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error while shutting down logger provider: %w", err))
+		}
+	}
+
+	if t.restoreEnv != nil {
+		if err := t.restoreEnv(); err != nil {
+			errs = append(errs, fmt.Errorf("error while restoring exemplar environment variables: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
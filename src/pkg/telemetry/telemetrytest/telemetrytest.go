@@ -0,0 +1,210 @@
+// Package telemetrytest installs in-memory span, metric and log exporters as the global providers, and offers
+// helpers for asserting on the telemetry recorded by the code under test
+package telemetrytest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agoda-com/opentelemetry-logs-go/sdk/logs/logstest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+)
+
+// Recorder gives access to the telemetry recorded since Install was called
+type Recorder struct {
+	Telemetry *telemetry.Telemetry
+}
+
+func Install(tb testing.TB, opts ...telemetry.Option) *Recorder {
+	/*
+		initialize telemetry with the `memory` exporter for all three signals, register the providers
+		globally and shut them down when the test completes. the admin server, if any, listens on an
+		ephemeral port, so that tests do not compete for ADMIN_PORT. opts are applied after the
+		defaults, so they may e.g. change the service name or the sampler.
+
+		the global providers are replaced on every call. tracers and meters should be obtained after
+		Install, e.g. through otel.Tracer, since instruments obtained before the first call stay bound
+		to the first providers registered
+	*/
+
+	tb.Helper()
+
+	opts = append([]telemetry.Option{
+		telemetry.WithServiceName("telemetrytest"),
+		telemetry.WithTracesExporter("memory"),
+		telemetry.WithMetricsExporter("memory"),
+		telemetry.WithLogsExporter("memory"),
+		telemetry.WithAdminPort("0"),
+	}, opts...)
+
+	tel, err := telemetry.Init(context.Background(), opts...)
+	if err != nil {
+		tb.Fatalf("telemetrytest: failed to initialize telemetry: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := tel.Shutdown(context.Background()); err != nil {
+			tb.Errorf("telemetrytest: failed to shut down telemetry: %v", err)
+		}
+	})
+
+	if tel.Memory == nil {
+		tb.Fatalf("telemetrytest: no signal records to memory, check that OTEL_SDK_DISABLED is not set")
+	}
+
+	return &Recorder{Telemetry: tel}
+}
+
+func (r *Recorder) Reset() {
+	/*
+		discard the spans and logs recorded so far. metrics are cumulative and cannot be reset
+	*/
+
+	if r.Telemetry.Memory.Spans != nil {
+		r.Telemetry.Memory.Spans.Reset()
+	}
+	if r.Telemetry.Memory.Logs != nil {
+		r.Telemetry.Memory.Logs.Reset()
+	}
+}
+
+func (r *Recorder) Spans(tb testing.TB) tracetest.SpanStubs {
+	/*
+		return every span that has ended, in the order they ended
+	*/
+
+	tb.Helper()
+
+	if r.Telemetry.Memory.Spans == nil {
+		tb.Fatalf("telemetrytest: traces are not recorded to memory")
+	}
+	return r.Telemetry.Memory.Spans.GetSpans()
+}
+
+func hasAttributes(actual []attribute.KeyValue, expected []attribute.KeyValue) bool {
+	/*
+		report whether every attribute in `expected` is present in `actual` with the same type and value
+	*/
+
+	set := attribute.NewSet(actual...)
+	for _, kv := range expected {
+		value, ok := set.Value(kv.Key)
+		if !ok || value.Type() != kv.Value.Type() || value.Emit() != kv.Value.Emit() {
+			return false
+		}
+	}
+	return true
+}
+
+func formatAttributes(attrs []attribute.KeyValue) string {
+	parts := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		parts = append(parts, fmt.Sprintf("%s=%s", kv.Key, kv.Value.Emit()))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (r *Recorder) AssertSpan(tb testing.TB, name string, attrs ...attribute.KeyValue) tracetest.SpanStub {
+	/*
+		assert that a span called `name` has ended and carries at least the given attributes, and return
+		the first such span. on failure the spans recorded with that name are listed, so that a missing
+		or mistyped attribute is easy to spot
+	*/
+
+	tb.Helper()
+
+	var candidates []string
+	for _, span := range r.Spans(tb) {
+		if span.Name != name {
+			continue
+		}
+		if hasAttributes(span.Attributes, attrs) {
+			return span
+		}
+		candidates = append(candidates, formatAttributes(span.Attributes))
+	}
+
+	if len(candidates) == 0 {
+		tb.Errorf("telemetrytest: no span named %q was recorded", name)
+	} else {
+		tb.Errorf(
+			"telemetrytest: no span named %q has attributes %s, recorded spans with that name have:\n\t%s",
+			name, formatAttributes(attrs), strings.Join(candidates, "\n\t"),
+		)
+	}
+	return tracetest.SpanStub{}
+}
+
+func (r *Recorder) Metrics(tb testing.TB) metricdata.ResourceMetrics {
+	/*
+		collect the current value of every metric recorded so far
+	*/
+
+	tb.Helper()
+
+	if r.Telemetry.Memory.Metrics == nil {
+		tb.Fatalf("telemetrytest: metrics are not recorded to memory")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := r.Telemetry.Memory.Metrics.Collect(context.Background(), &rm); err != nil {
+		tb.Fatalf("telemetrytest: failed to collect metrics: %v", err)
+	}
+	return rm
+}
+
+func (r *Recorder) FindMetric(tb testing.TB, name string) (metricdata.Metrics, bool) {
+	/*
+		collect metrics and return the metric called `name`, from whichever instrumentation scope
+		recorded it. the returned bool is false if no such metric has been recorded
+	*/
+
+	tb.Helper()
+
+	rm := r.Metrics(tb)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m, true
+			}
+		}
+	}
+	return metricdata.Metrics{}, false
+}
+
+func (r *Recorder) Logs(tb testing.TB) logstest.LogRecordStubs {
+	/*
+		return every log record written so far, in the order they were written
+	*/
+
+	tb.Helper()
+
+	if r.Telemetry.Memory.Logs == nil {
+		tb.Fatalf("telemetrytest: logs are not recorded to memory")
+	}
+	return r.Telemetry.Memory.Logs.GetLogs()
+}
+
+func (r *Recorder) LogsForTrace(tb testing.TB, traceID trace.TraceID) logstest.LogRecordStubs {
+	/*
+		return the log records written within the trace identified by `traceID`, e.g. the trace ID of a
+		span returned by AssertSpan
+	*/
+
+	tb.Helper()
+
+	var logs logstest.LogRecordStubs
+	for _, record := range r.Logs(tb) {
+		if record.TraceId != nil && *record.TraceId == traceID {
+			logs = append(logs, record)
+		}
+	}
+	return logs
+}
@@ -0,0 +1,127 @@
+package telemetrytest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agoda-com/opentelemetry-go/otelzap"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+)
+
+// failureRecorder captures the failures reported through Errorf, so that failing assertions can be tested
+type failureRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (f *failureRecorder) Errorf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertSpan(t *testing.T) {
+	rec := Install(t)
+
+	_, span := otel.Tracer("telemetrytest").Start(context.Background(), "work",
+		trace.WithAttributes(attribute.String("tenant.id", "a"), attribute.Int("attempt", 1)),
+	)
+	span.End()
+
+	got := rec.AssertSpan(t, "work", attribute.String("tenant.id", "a"))
+	if got.SpanContext.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("AssertSpan returned span %s, want %s", got.SpanContext.SpanID(), span.SpanContext().SpanID())
+	}
+
+	for _, tc := range []struct {
+		name    string
+		span    string
+		attrs   []attribute.KeyValue
+		message string
+	}{
+		{"missing span", "other", nil, `no span named "other"`},
+		{"wrong value", "work", []attribute.KeyValue{attribute.String("tenant.id", "b")}, "attempt=1"},
+		{"wrong type", "work", []attribute.KeyValue{attribute.String("attempt", "1")}, "tenant.id=a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			failures := &failureRecorder{TB: t}
+			rec.AssertSpan(failures, tc.span, tc.attrs...)
+			if len(failures.failures) != 1 || !strings.Contains(failures.failures[0], tc.message) {
+				t.Errorf("AssertSpan reported %q, want a failure mentioning %q", failures.failures, tc.message)
+			}
+		})
+	}
+
+	rec.Reset()
+	if spans := rec.Spans(t); len(spans) != 0 {
+		t.Errorf("Spans returned %d spans after Reset, want 0", len(spans))
+	}
+}
+
+func TestFindMetric(t *testing.T) {
+	rec := Install(t)
+
+	counter, err := otel.Meter("telemetrytest").Int64Counter("telemetrytest.requests")
+	if err != nil {
+		t.Fatalf("failed to create counter: %v", err)
+	}
+	counter.Add(context.Background(), 2)
+	counter.Add(context.Background(), 3)
+
+	m, ok := rec.FindMetric(t, "telemetrytest.requests")
+	if !ok {
+		t.Fatalf("FindMetric did not find telemetrytest.requests")
+	}
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	if !ok || len(sum.DataPoints) != 1 {
+		t.Fatalf("telemetrytest.requests has data %#v, want a single int64 sum data point", m.Data)
+	}
+	if got := sum.DataPoints[0].Value; got != 5 {
+		t.Errorf("telemetrytest.requests = %d, want 5", got)
+	}
+
+	if _, ok := rec.FindMetric(t, "telemetrytest.missing"); ok {
+		t.Errorf("FindMetric found telemetrytest.missing, which was never recorded")
+	}
+}
+
+func TestLogsForTrace(t *testing.T) {
+	rec := Install(t)
+
+	ctx, span := otel.Tracer("telemetrytest").Start(context.Background(), "work")
+	otelzap.Ctx(ctx).Info("within the span")
+	span.End()
+	otelzap.Ctx(context.Background()).Info("outside of any span")
+
+	if got := len(rec.Logs(t)); got != 2 {
+		t.Errorf("Logs returned %d records, want 2", got)
+	}
+
+	logs := rec.LogsForTrace(t, span.SpanContext().TraceID())
+	if len(logs) != 1 {
+		t.Fatalf("LogsForTrace returned %d records, want 1", len(logs))
+	}
+	if body := logs[0].Body; body == nil || *body != "within the span" {
+		t.Errorf("LogsForTrace returned a record with body %v, want %q", body, "within the span")
+	}
+}
+
+func TestInstallTwice(t *testing.T) {
+	// the admin API starts the admin server, which must not compete for a fixed port
+	first := Install(t, telemetry.WithAdminToken("token"))
+	second := Install(t, telemetry.WithAdminToken("token"), telemetry.WithServiceName("second"))
+
+	_, span := otel.Tracer("telemetrytest").Start(context.Background(), "work")
+	span.End()
+
+	second.AssertSpan(t, "work")
+	if spans := first.Spans(t); len(spans) != 0 {
+		t.Errorf("the first recorder has %d spans, want 0 once the providers were replaced", len(spans))
+	}
+}
@@ -0,0 +1,233 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type noopSpanExporter struct{}
+
+func (e *noopSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+func (e *noopSpanExporter) Shutdown(ctx context.Context) error { return nil }
+
+func newSpanExporter(ctx context.Context, cfg *config, exporterType string) (sdktrace.SpanExporter, error) {
+	/*
+		resolve which span exporter to use from the value of exporterType
+	*/
+
+	switch exporterType {
+	case exporterStdout:
+		// export traces to stdout of this service
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case exporterOTLP, exporterOTLPHTTP:
+		settings, err := resolveOTLPSettings("traces", exporterType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TracerProvider: %w", err)
+		}
+		// export traces to an otel collector
+		if cfg.exportBufferEnabled("traces") {
+			// failed batches are retried by replaying them from the buffer
+			settings.withoutRetry = true
+			return otlptrace.New(ctx, newBufferedTraceClient(newOTLPTraceClient(settings)))
+		}
+		return otlptrace.New(ctx, newOTLPTraceClient(settings))
+	case exporterFile:
+		// export traces as OTLP/JSON lines to a local file
+		return otlptrace.New(ctx, &fileTraceClient{fileClient{settings: resolveFileSettings("traces")}})
+	default:
+		// if no exporter type is indicated, no spans will be exported
+		return &noopSpanExporter{}, nil
+	}
+}
+
+func newOTLPTraceClient(settings *otlpSettings) otlptrace.Client {
+	/*
+		construct a grpc or http/protobuf OTLP client for traces from the resolved settings
+	*/
+
+	if settings.protocol == protocolHTTPProtobuf {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(settings.endpoint),
+			otlptracehttp.WithURLPath(settings.urlPath),
+			otlptracehttp.WithHeaders(settings.headers),
+		}
+		if settings.insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(settings.tlsConfig))
+		}
+		if settings.compression == compressionGzip {
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlptracehttp.WithTimeout(settings.timeout))
+		}
+		if settings.withoutRetry {
+			opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}))
+		}
+		return otlptracehttp.NewClient(opts...)
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(settings.endpoint),
+		otlptracegrpc.WithHeaders(settings.headers),
+	}
+	if settings.insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+	}
+	if settings.compression == compressionGzip {
+		opts = append(opts, otlptracegrpc.WithCompressor(compressionGzip))
+	}
+	if settings.timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(settings.timeout))
+	}
+	if settings.withoutRetry {
+		opts = append(opts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}))
+	}
+	return otlptracegrpc.NewClient(opts...)
+}
+
+// namedSpanExporter prefixes export errors with the type of the wrapped exporter, so that with several exporters
+// configured it is clear which one failed, and records the duration and outcome of every export
+type namedSpanExporter struct {
+	sdktrace.SpanExporter
+	name     string
+	observer *exportObserver
+	// enabled is switched through the admin API. spans passed to a disabled exporter are dropped
+	enabled *atomic.Bool
+	// queue is the bound of the batch processor in front of the exporter, nil for a simple processor
+	queue *queueBound
+}
+
+func (e *namedSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.queue.release(len(spans))
+	if !e.enabled.Load() {
+		return nil
+	}
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.observer.record(ctx, start, len(spans), err)
+	if err != nil {
+		return &exportError{signal: "traces", exporter: e.name, err: err}
+	}
+	return nil
+}
+
+func (e *namedSpanExporter) Shutdown(ctx context.Context) error {
+	if err := e.SpanExporter.Shutdown(ctx); err != nil {
+		return fmt.Errorf("traces exporter %s: %w", e.name, err)
+	}
+	return nil
+}
+
+func batchSpanProcessorOptions(ps *processorSettings) []sdktrace.BatchSpanProcessorOption {
+	/*
+		spans are exported every second unless OTEL_BSP_SCHEDULE_DELAY says otherwise. the settings of a
+		batch processor in the configuration file apply where the matching OTEL_BSP_* variable is unset.
+		the processor blocks rather than drops spans when its queue is full, which the queueBound in
+		front of it never lets happen
+	*/
+
+	opts := []sdktrace.BatchSpanProcessorOption{sdktrace.WithBlocking()}
+	if _, ok := os.LookupEnv("OTEL_BSP_SCHEDULE_DELAY"); !ok {
+		delay := time.Second
+		if ps != nil && ps.scheduleDelay > 0 {
+			delay = ps.scheduleDelay
+		}
+		opts = append(opts, sdktrace.WithBatchTimeout(delay))
+	}
+	if ps == nil {
+		return opts
+	}
+	if _, ok := os.LookupEnv("OTEL_BSP_EXPORT_TIMEOUT"); !ok && ps.exportTimeout > 0 {
+		opts = append(opts, sdktrace.WithExportTimeout(ps.exportTimeout))
+	}
+	if _, ok := os.LookupEnv("OTEL_BSP_MAX_QUEUE_SIZE"); !ok && ps.maxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(ps.maxQueueSize))
+	}
+	if _, ok := os.LookupEnv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE"); !ok && ps.maxExportBatchSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(ps.maxExportBatchSize))
+	}
+	return opts
+}
+
+func newTracerProvider(
+	ctx context.Context, cfg *config, res *resource.Resource, mem *Memory, pipeline *pipelineMetrics,
+	controls *runtimeControls, processors *signalProcessors,
+) (*sdktrace.TracerProvider, error) {
+	/*
+		construct a tracer provider that samples spans according to the configured sampler, and exports
+		them to every backend in cfg.tracesExporters. each exporter gets its own batch span processor,
+		so a slow or failing exporter does not hold up the others. spans recorded in memory are exported
+		as soon as they end, so that tests can inspect them without flushing the provider. any
+		redaction rules are applied once per span, ahead of all exporters
+	*/
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(controls.sampler),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(&spanCountProcessor{metrics: pipeline}),
+	}
+	for _, processor := range processors.spans {
+		opts = append(opts, sdktrace.WithSpanProcessor(processor))
+	}
+
+	var exporters []sdktrace.SpanExporter
+	var exporting []sdktrace.SpanProcessor
+	for _, exporterType := range cfg.tracesExporters {
+		if exporterType == exporterMemory {
+			exporting = append(exporting, sdktrace.NewSimpleSpanProcessor(mem.Spans))
+			continue
+		}
+
+		traceExporter, err := newSpanExporter(ctx, cfg, exporterType)
+		if err != nil {
+			for _, exporter := range exporters {
+				err = errors.Join(err, exporter.Shutdown(ctx))
+			}
+			return nil, err
+		}
+		exporters = append(exporters, traceExporter)
+
+		named := &namedSpanExporter{
+			SpanExporter: traceExporter,
+			name:         exporterType,
+			observer:     pipeline.newExportObserver("traces", exporterType),
+			enabled:      controls.exporterEnabled("traces"),
+		}
+		ps := cfg.processorSettings("traces", exporterType)
+		if ps != nil && ps.simple {
+			exporting = append(exporting, sdktrace.NewSimpleSpanProcessor(named))
+			continue
+		}
+
+		named.queue = pipeline.newQueueBound("traces",
+			maxQueueSize("OTEL_BSP_MAX_QUEUE_SIZE", ps, sdktrace.DefaultMaxQueueSize))
+		processor := sdktrace.NewBatchSpanProcessor(named, batchSpanProcessorOptions(ps)...)
+		exporting = append(exporting, &boundedSpanProcessor{SpanProcessor: processor, bound: named.queue})
+	}
+
+	for _, processor := range processors.exportingSpans(exporting) {
+		opts = append(opts, sdktrace.WithSpanProcessor(processor))
+	}
+
+	return sdktrace.NewTracerProvider(opts...), nil
+}
@@ -0,0 +1,132 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// requestErrorCategory classifies the failures of Request, and is recorded as `error.type` on the span
+type requestErrorCategory string
+
+const (
+	errorCategoryEncode       requestErrorCategory = "encode_request"
+	errorCategoryRequest      requestErrorCategory = "create_request"
+	errorCategoryTransport    requestErrorCategory = "transport"
+	errorCategoryTimeout      requestErrorCategory = "timeout"
+	errorCategoryRefused      requestErrorCategory = "connection_refused"
+	errorCategoryUpstream     requestErrorCategory = "upstream_status"
+	errorCategoryReadResponse requestErrorCategory = "read_response"
+	errorCategoryDecode       requestErrorCategory = "decode_response"
+	errorCategoryMissingField requestErrorCategory = "missing_field"
+)
+
+// maxUpstreamErrorBody is the number of bytes of a non-2xx response body kept in an UpstreamError
+const maxUpstreamErrorBody = 1024
+
+// UpstreamError is returned by Request when a downstream service responds with a non-2xx status
+type UpstreamError struct {
+	Status  int
+	Body    string
+	Service string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s responded with status %d: %s", e.Service, e.Status, e.Body)
+}
+
+// TimeoutError is returned by Request when a downstream service does not respond in time
+type TimeoutError struct {
+	Service string
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request to %s timed out: %v", e.Service, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectionRefusedError is returned by Request when a downstream service is not accepting connections
+type ConnectionRefusedError struct {
+	Service string
+	Err     error
+}
+
+func (e *ConnectionRefusedError) Error() string {
+	return fmt.Sprintf("connection to %s refused: %v", e.Service, e.Err)
+}
+
+func (e *ConnectionRefusedError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned by Request when the 2xx response of a downstream service cannot be understood
+type DecodeError struct {
+	Service string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid response from %s: %v", e.Service, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func Status(err error) int {
+	/*
+		return the status to respond with when a call to a downstream service failed with `err`. a 4xx
+		from the downstream service is passed through, as the request was at fault rather than this
+		service. a timeout is a 504, a refused connection a 503, and any other failure of the downstream
+		service, or of the connection to it, a 502. errors that happened before the request was sent
+		are a 500
+	*/
+
+	var (
+		upstreamErr *UpstreamError
+		timeoutErr  *TimeoutError
+		refusedErr  *ConnectionRefusedError
+		decodeErr   *DecodeError
+		urlErr      *url.Error
+	)
+	switch {
+	case errors.As(err, &upstreamErr):
+		if upstreamErr.Status >= http.StatusBadRequest && upstreamErr.Status < http.StatusInternalServerError {
+			return upstreamErr.Status
+		}
+		return http.StatusBadGateway
+	case errors.As(err, &timeoutErr):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &refusedErr):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &decodeErr), errors.As(err, &urlErr):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func transportError(service string, err error) (requestErrorCategory, error) {
+	/*
+		classify an error returned by http.Client.Do as a timeout or a refused connection. any other error is
+		returned as it is
+	*/
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errorCategoryTimeout, &TimeoutError{Service: service, Err: err}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorCategoryRefused, &ConnectionRefusedError{Service: service, Err: err}
+	default:
+		return errorCategoryTransport, err
+	}
+}
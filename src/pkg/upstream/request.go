@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordRequestError(span trace.Span, category requestErrorCategory, err error) {
+	/*
+		record `err` on `span` as an exception event, and mark the span as failed
+	*/
+
+	categoryAttr := semconv.ErrorTypeKey.String(string(category))
+	span.RecordError(err, trace.WithAttributes(categoryAttr))
+	span.SetAttributes(categoryAttr)
+	span.SetStatus(codes.Error, fmt.Sprintf("%s: %v", category, err))
+}
+
+func newIdempotencyKey() (string, error) {
+	/*
+		return a random key that identifies every attempt of a single call as the same request
+	*/
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func Request(
+	ctx context.Context, client *http.Client, service string, target string, method string, payload any,
+	responseField string,
+) (string, error) {
+	/*
+		send `payload` as JSON to the `target` URL of `service` through `client`. if the response JSON
+		includes a field that matches the `responseField` string, return it. failures of the downstream
+		service are returned as an UpstreamError, TimeoutError, ConnectionRefusedError or DecodeError, which
+		Status maps to the status to respond with. the request carries an Idempotency-Key header, which
+		is the same for every attempt of this call, so that the httpretry transport retries it after a
+		transient failure whatever its method
+	*/
+
+	span := trace.SpanFromContext(ctx)
+
+	// construct request JSON from the payload
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		recordRequestError(span, errorCategoryEncode, err)
+		return "failed to construct JSON for request", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewBuffer(jsonData))
+	if err != nil {
+		recordRequestError(span, errorCategoryRequest, err)
+		return "failed to create request", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	key, err := newIdempotencyKey()
+	if err != nil {
+		recordRequestError(span, errorCategoryRequest, err)
+		return "failed to create request", err
+	}
+	req.Header.Set("Idempotency-Key", key)
+
+	span.AddEvent("request sent", trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLFull(target),
+		semconv.HTTPRequestBodySize(len(jsonData)),
+	))
+	resp, err := client.Do(req)
+	if err != nil {
+		category, err := transportError(service, err)
+		recordRequestError(span, category, err)
+		return "failed to send request", err
+	}
+	defer func(resp *http.Response) {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Printf("Error while closing HTTP Response body: %v\n", err)
+		}
+	}(resp)
+
+	// read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		category, err := transportError(service, err)
+		if category == errorCategoryTransport {
+			category = errorCategoryReadResponse
+		}
+		recordRequestError(span, category, err)
+		return "failed to read response body", err
+	}
+	span.AddEvent("response received", trace.WithAttributes(
+		semconv.HTTPResponseStatusCode(resp.StatusCode),
+		semconv.HTTPResponseBodySize(len(body)),
+	))
+
+	// the body of a non-2xx response describes the failure, rather than carrying the response field
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err := &UpstreamError{
+			Status:  resp.StatusCode,
+			Body:    string(body[:min(len(body), maxUpstreamErrorBody)]),
+			Service: service,
+		}
+		recordRequestError(span, errorCategoryUpstream, err)
+		return fmt.Sprintf("request to %s API of %s failed", target, service), err
+	}
+
+	// construct string map from response body
+	var responseMap map[string]string
+	if err := json.Unmarshal(body, &responseMap); err != nil {
+		err := &DecodeError{Service: service, Err: err}
+		recordRequestError(span, errorCategoryDecode, err)
+		return "failed to parse response JSON", err
+	}
+
+	if responseMap[responseField] == "" {
+		err := &DecodeError{Service: service, Err: errors.New("response empty")}
+		recordRequestError(span, errorCategoryMissingField, err)
+		return fmt.Sprintf("response from %s API of %s did not contain a `%s` key", target, service, responseField), err
+	}
+
+	return responseMap[responseField], nil
+}
@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRequest(t *testing.T) {
+	// a listener that is closed right away gives an address that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	refused := "http://" + listener.Addr().String()
+	_ = listener.Close()
+
+	for _, tc := range []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		want       string
+		wantErr    any
+		wantStatus int
+	}{
+		{
+			name: "success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Idempotency-Key") == "" {
+					http.Error(w, "missing Idempotency-Key", http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(`{"number":"3"}`))
+			},
+			want: "3",
+		},
+		{
+			name: "client error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "invalid request payload", http.StatusBadRequest)
+			},
+			wantErr:    new(*UpstreamError),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantErr:    new(*UpstreamError),
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// once the body is read, the request context ends when the client closes the connection
+				_, _ = io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			wantErr:    new(*TimeoutError),
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "connection refused",
+			target:     refused,
+			wantErr:    new(*ConnectionRefusedError),
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "missing field",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"message":"no number"}`))
+			},
+			wantErr:    new(*DecodeError),
+			wantStatus: http.StatusBadGateway,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			target := tc.target
+			if tc.handler != nil {
+				server := httptest.NewServer(tc.handler)
+				t.Cleanup(server.Close)
+				target = server.URL
+			}
+
+			client := &http.Client{Timeout: 100 * time.Millisecond}
+			got, err := Request(context.Background(), client, "service_b", target, http.MethodPost,
+				map[string]int{"number": 1}, "number",
+			)
+			if tc.wantErr == nil {
+				if err != nil || got != tc.want {
+					t.Fatalf("Request returned %q, %v, want %q", got, err, tc.want)
+				}
+				return
+			}
+			if !errors.As(err, tc.wantErr) {
+				t.Fatalf("Request returned %v (%T), want a %s", err, err, reflect.TypeOf(tc.wantErr).Elem())
+			}
+			if status := Status(err); status != tc.wantStatus {
+				t.Errorf("Status(%v) = %d, want %d", err, status, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -10,53 +10,80 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/agoda-com/opentelemetry-go/otelzap"
+	"github.com/bengetch/otel-go/src/pkg/httpmetrics"
+	"github.com/bengetch/otel-go/src/pkg/httpretry"
+	"github.com/bengetch/otel-go/src/pkg/server"
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
+	"github.com/bengetch/otel-go/src/pkg/upstream"
 	"github.com/gin-gonic/gin"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 )
 
 var (
 	ServiceName      string
 	Client           *http.Client
+	Propagator       propagation.TextMapPropagator
 	EndpointServiceB = os.Getenv("ENDPOINT_SERVICE_B")
 	SelfPort         = os.Getenv("SELF_PORT")
 )
 
 func initServiceName() {
-	ServiceName = os.Getenv("SERVICE_NAME")
+	ServiceName = telemetry.ServiceNameFromEnv()
 	if ServiceName == "" {
-		log.Fatal("SERVICE_NAME environment variable not set")
+		log.Fatal("OTEL_SERVICE_NAME environment variable not set")
 	}
 }
 
-func initHttpClient() {
+func initHttpClient(propagator propagation.TextMapPropagator) {
 	/*
 		create an http.Client instance with otelhttp transport configured. this transport configuration
-		ensures that trace context is correctly propagated across http requests
+		ensures that trace context is correctly propagated across http requests, in every format
+		selected through OTEL_PROPAGATORS. the httpmetrics transport within it records the latency of
+		every call, with `peer.service` naming the service that was called. the httpretry transport
+		around it sends a request again after a transient failure, with each attempt traced on its own
 	*/
 
+	transport := httpmetrics.NewTransport(
+		http.DefaultTransport,
+		httpmetrics.WithPeerService(EndpointServiceB, "service_b"),
+	)
 	Client = &http.Client{
 		Timeout:   time.Second * 10,
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: httpretry.NewTransport(otelhttp.NewTransport(transport, otelhttp.WithPropagators(propagator))),
+	}
+}
+
+func initTelemetry() *telemetry.Telemetry {
+	/*
+		configure logger, tracer and meter providers for this service. the exporter used for each
+		telemetry type is indicated by the OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER and
+		OTEL_LOGS_EXPORTER environment variables
+	*/
+
+	tel, err := telemetry.Init(context.Background(), telemetry.WithServiceName(ServiceName))
+	if err != nil {
+		log.Fatalf("Failed to initialize telemetry: %v\n", err)
 	}
+
+	return tel
 }
 
 func main() {
 
 	initServiceName()
-	initHttpClient()
 
-	logProvider := SetupLogs()
-	tracerProvider := SetupTraces()
-	meterProvider := SetupMetrics()
-	defer CleanupTelemetryProviders(logProvider, tracerProvider, meterProvider)
+	tel := initTelemetry()
+	Propagator = tel.Propagator
+	initHttpClient(Propagator)
 
 	router := gin.Default()
-	router.Use(otelgin.Middleware(ServiceName))
+	router.Use(
+		otelgin.Middleware(ServiceName, otelgin.WithPropagators(tel.Propagator)),
+		httpmetrics.Middleware(),
+	)
 
 	router.GET("/", hello)
 	router.POST("/basicRequest", basicRequest)
@@ -64,17 +91,20 @@ func main() {
 	router.POST("/chainedAsyncRequest", chainedAsyncRequest)
 	router.POST("/addNumber", addNumber)
 
-	err := router.Run(fmt.Sprintf("0.0.0.0:%s", SelfPort))
+	// serve until SIGINT/SIGTERM, then drain in-flight requests and flush telemetry before exiting
+	err := server.Run(
+		fmt.Sprintf("0.0.0.0:%s", SelfPort),
+		router,
+		server.WithShutdownHook(tel.Shutdown),
+	)
 	if err != nil {
-		otelzap.Ctx(context.Background()).Fatal(
-			fmt.Sprintf("Failed to start the server: %v\n", err),
-		)
+		log.Fatalf("Server exited with error: %v\n", err)
 	}
 }
 
 func hello(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/` API of service %s", ServiceName),
 	)
 
@@ -88,7 +118,7 @@ type BasicPayload struct {
 
 func basicRequest(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/basicRequest` API of service %s", ServiceName),
 	)
 
@@ -108,7 +138,7 @@ func basicRequest(c *gin.Context) {
 
 func chainedRequest(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/chainedRequest` API of service %s", ServiceName),
 	)
 
@@ -126,15 +156,17 @@ func chainedRequest(c *gin.Context) {
 		Number:  payload.Number + rand.Intn(11),
 	}
 
-	response, status, err := makeRequest(
-		&requestToB,
+	response, err := upstream.Request(
+		c.Request.Context(),
+		Client,
+		"service_b",
 		fmt.Sprintf("http://%s/chainedRequest", EndpointServiceB),
 		"POST",
+		&requestToB,
 		"number",
-		c.Request.Context(),
 	)
 	if err != nil {
-		c.AbortWithStatusJSON(status, gin.H{
+		c.AbortWithStatusJSON(upstream.Status(err), gin.H{
 			"message": fmt.Sprintf("%s: %v", response, err),
 		})
 	} else {
@@ -146,21 +178,23 @@ func chainedRequest(c *gin.Context) {
 
 func makeAsyncRequest(payload *BasicPayload, ctx context.Context) {
 
-	response, _, err := makeRequest(
-		payload,
+	response, err := upstream.Request(
+		ctx,
+		Client,
+		"service_b",
 		fmt.Sprintf("http://%s/chainedRequest", EndpointServiceB),
 		"POST",
+		payload,
 		"number",
-		ctx,
 	)
 
 	// wait 10 seconds to ensure that below logs fire after response has been sent
 	time.Sleep(10 * time.Second)
 
 	if err != nil {
-		log.Printf("Err: %v", err)
+		telemetry.Ctx(ctx).Error(fmt.Sprintf("async request to service B failed: %v", err))
 	} else {
-		log.Printf("number from service B: %s", response)
+		telemetry.Ctx(ctx).Info(fmt.Sprintf("number from service B: %s", response))
 	}
 }
 
@@ -170,18 +204,17 @@ func newContext(oldContext context.Context, header http.Header) context.Context
 		data for current trace
 	*/
 
-	propagator := otel.GetTextMapPropagator()
-	extractedCtx := propagator.Extract(oldContext, propagation.HeaderCarrier(header))
+	extractedCtx := Propagator.Extract(oldContext, propagation.HeaderCarrier(header))
 	newCtx := context.Background()
 	carrier := propagation.MapCarrier{}
-	propagator.Inject(extractedCtx, carrier)
+	Propagator.Inject(extractedCtx, carrier)
 
-	return propagator.Extract(newCtx, carrier)
+	return Propagator.Extract(newCtx, carrier)
 }
 
 func chainedAsyncRequest(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/chainedAsyncRequest` API of service %s", ServiceName),
 	)
 
@@ -208,7 +241,7 @@ func chainedAsyncRequest(c *gin.Context) {
 
 func addNumber(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/addNumber` API of service %s", ServiceName),
 	)
 
@@ -9,7 +9,9 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/agoda-com/opentelemetry-go/otelzap"
+	"github.com/bengetch/otel-go/src/pkg/httpmetrics"
+	"github.com/bengetch/otel-go/src/pkg/server"
+	"github.com/bengetch/otel-go/src/pkg/telemetry"
 	"github.com/gin-gonic/gin"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
@@ -21,40 +23,58 @@ var (
 )
 
 func initServiceName() {
-	ServiceName = os.Getenv("SERVICE_NAME")
+	ServiceName = telemetry.ServiceNameFromEnv()
 	if ServiceName == "" {
-		log.Fatal("SERVICE_NAME environment variable not set")
+		log.Fatal("OTEL_SERVICE_NAME environment variable not set")
 	}
 }
 
+func initTelemetry() *telemetry.Telemetry {
+	/*
+		configure logger, tracer and meter providers for this service. the exporter used for each
+		telemetry type is indicated by the OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER and
+		OTEL_LOGS_EXPORTER environment variables
+	*/
+
+	tel, err := telemetry.Init(context.Background(), telemetry.WithServiceName(ServiceName))
+	if err != nil {
+		log.Fatalf("Failed to initialize telemetry: %v\n", err)
+	}
+
+	return tel
+}
+
 func main() {
 
 	initServiceName()
 
-	logProvider := SetupLogs()
-	tracerProvider := SetupTraces()
-	meterProvider := SetupMetrics()
-	defer CleanupTelemetryProviders(logProvider, tracerProvider, meterProvider)
+	tel := initTelemetry()
 
 	router := gin.Default()
-	router.Use(otelgin.Middleware(ServiceName))
+	router.Use(
+		otelgin.Middleware(ServiceName, otelgin.WithPropagators(tel.Propagator)),
+		httpmetrics.Middleware(),
+	)
 
 	// configure gin server API
 	router.GET("/", hello)
 	router.POST("/basicRequest", basicRequest)
 	router.POST("/chainedRequest", chainedRequest)
 
-	err := router.Run(fmt.Sprintf("0.0.0.0:%s", SelfPort))
+	// serve until SIGINT/SIGTERM, then drain in-flight requests and flush telemetry before exiting
+	err := server.Run(
+		fmt.Sprintf("0.0.0.0:%s", SelfPort),
+		router,
+		server.WithShutdownHook(tel.Shutdown),
+	)
 	if err != nil {
-		otelzap.Ctx(context.Background()).Fatal(
-			fmt.Sprintf("Failed to start the server: %v\n", err),
-		)
+		log.Fatalf("Server exited with error: %v\n", err)
 	}
 }
 
 func hello(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/` API of service %s", ServiceName),
 	)
 
@@ -68,7 +88,7 @@ type BasicPayload struct {
 
 func basicRequest(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/basicRequest` API of service %s", ServiceName),
 	)
 
@@ -88,7 +108,7 @@ func basicRequest(c *gin.Context) {
 
 func chainedRequest(c *gin.Context) {
 
-	otelzap.Ctx(c.Request.Context()).Info(
+	telemetry.Ctx(c.Request.Context()).Info(
 		fmt.Sprintf("hello from `/chainedRequest` API of service %s", ServiceName),
 	)
 